@@ -2,227 +2,521 @@ package aggregator
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"flight-aggregator/airports"
+	"flight-aggregator/fanout"
 	"flight-aggregator/models"
 	"flight-aggregator/providers"
 )
 
+var (
+	// ErrInvalidRequest wraps the *models.ValidationError of a rejected search request.
+	ErrInvalidRequest = errors.New("invalid search request")
+	// ErrAllProvidersFailed is returned when every queried provider failed to return flights.
+	ErrAllProvidersFailed = errors.New("all providers failed")
+)
+
 type AggregatorService struct {
 	providers []providers.Provider
+	now       func() time.Time
+	interline InterlineConfig
+
+	cache         Cache
+	providerCache *providerCache
+	inflight      searchGroup
+
+	maxParallelFetches int
+
+	softDeadline  SoftDeadline
+	retry         RetryPolicy
+	providerRetry map[string]RetryPolicy
+
+	breakerConfig BreakerConfig
+	breakersMu    sync.Mutex
+	breakers      map[string]*circuitBreaker
+
+	disabledMu sync.RWMutex
+	disabled   map[string]bool
+}
+
+// Option customizes an AggregatorService.
+type Option func(*AggregatorService)
+
+// WithClock overrides the clock used to reject past departure dates.
+func WithClock(now func() time.Time) Option {
+	return func(s *AggregatorService) {
+		s.now = now
+	}
 }
 
-func NewAggregatorService(p []providers.Provider) *AggregatorService {
-	return &AggregatorService{providers: p}
+// WithMaxParallelFetches bounds the provider calls a search runs at once, counting
+// every airport of a city code, every hub leg and every leg or date of a round-trip,
+// multi-city or flexible search.
+func WithMaxParallelFetches(n int) Option {
+	return func(s *AggregatorService) {
+		if n > 0 {
+			s.maxParallelFetches = n
+		}
+	}
+}
+
+func NewAggregatorService(p []providers.Provider, opts ...Option) *AggregatorService {
+	s := &AggregatorService{
+		providers:          p,
+		now:                time.Now,
+		interline:          DefaultInterlineConfig(),
+		cache:              newServiceCache(),
+		providerCache:      newProviderCache(DefaultProviderCacheOptions()),
+		maxParallelFetches: 8,
+		retry:              DefaultRetryPolicy(),
+		breakerConfig:      DefaultBreakerConfig(),
+		breakers:           make(map[string]*circuitBreaker),
+		disabled:           make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *AggregatorService) Search(ctx context.Context, req models.SearchRequest) (models.SearchResponse, error) {
 	start := time.Now()
-	key := cacheKey(req)
-	resp, found := aggCache.Get(key)
+	if err := req.Validate(s.now()); err != nil {
+		return models.SearchResponse{SearchCriteria: req}, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	provs := s.activeProviders()
+	key := cacheKey(req, providerNames(provs))
+	resp, found := s.cache.Get(key)
 	if found {
+		// The entry may come from an equivalent but differently written request
+		resp.SearchCriteria = req
 		resp.Metadata.SearchTimeMs = time.Since(start).Milliseconds()
 		resp.Metadata.CacheHit = true
 		return resp, nil
 	}
 
-
 	// Check for context timeout before starting provider calls
 	if ctx.Err() != nil {
 		return models.SearchResponse{
 			SearchCriteria: req,
-			Metadata: models.Metadata{
-				TotalResults:       0,
-				ProvidersQueried:   len(s.providers),
-				ProvidersSucceeded: 0,
-				ProvidersFailed:    len(s.providers),
-				SearchTimeMs:       time.Since(start).Milliseconds(),
-				CacheHit:           false,
-			},
-			Flights: nil,
+			Metadata:       s.metadata(0, fetchResult{}, start),
+			Flights:        nil,
 		}, ctx.Err()
 	}
 
-	results, successCount, err := s.fetchFromProviders(ctx, req)
+	// Identical searches in flight share one fan-out; the response is theirs to adjust
+	resp, err := s.inflight.do(ctx, key, func(ctx context.Context) (models.SearchResponse, error) {
+		return s.search(ctx, provs, req, start)
+	})
+	resp.SearchCriteria = req
+	resp.Metadata.SearchTimeMs = time.Since(start).Milliseconds()
+	return resp, err
+}
+
+// search fetches from provs and runs the pipeline, caching complete responses.
+func (s *AggregatorService) search(ctx context.Context, provs []providers.Provider, req models.SearchRequest, start time.Time) (models.SearchResponse, error) {
+	// Hub legs and any stragglers warming the cache share the search's fetch slots
+	ctx = s.withFetchSlots(ctx)
+	fetched, err := s.fetchFromProviders(ctx, provs, req)
+	if err == nil {
+		// Check for context timeout after provider calls
+		err = s.fetchErr(ctx, fetched)
+	}
 	if err != nil {
 		return models.SearchResponse{
 			SearchCriteria: req,
-			Metadata: models.Metadata{
-				TotalResults:       0,
-				ProvidersQueried:   len(s.providers),
-				ProvidersSucceeded: successCount,
-				ProvidersFailed:    len(s.providers) - successCount,
-				SearchTimeMs:       time.Since(start).Milliseconds(),
-				CacheHit:           false,
-			},
-			Flights: nil,
+			Metadata:       s.metadata(0, fetched, start),
+			Flights:        nil,
 		}, err
 	}
 
-	// Check for context timeout after provider calls
-	if ctx.Err() != nil {
-		return models.SearchResponse{
-			SearchCriteria: req,
-			Metadata: models.Metadata{
-				TotalResults:       0,
-				ProvidersQueried:   len(s.providers),
-				ProvidersSucceeded: successCount,
-				ProvidersFailed:    len(s.providers) - successCount,
-				SearchTimeMs:       time.Since(start).Milliseconds(),
-				CacheHit:           false,
-			},
-			Flights: nil,
-			}, ctx.Err()
-	}
-
-	filtered, err := s.filterFlights(results, req)
+	fetched = s.connectingLegs(ctx, fetched, req, start)
+	sorted, err := s.pipeline(fetched.flights, req)
 	if err != nil {
 		return models.SearchResponse{
 			SearchCriteria: req,
-			Metadata: models.Metadata{
-				TotalResults:       0,
-				ProvidersQueried:   len(s.providers),
-				ProvidersSucceeded: successCount,
-				ProvidersFailed:    len(s.providers) - successCount,
-				SearchTimeMs:       time.Since(start).Milliseconds(),
-				CacheHit:           false,
-			},
-			Flights: nil,
+			Metadata:       s.metadata(0, fetched, start),
+			Flights:        nil,
 		}, err
 	}
 
+	resp := models.SearchResponse{
+		SearchCriteria: req,
+		Metadata:       s.metadata(len(sorted), fetched, start),
+		Flights:        sorted,
+	}
+	if fetched.complete() {
+		// Keyed by the providers that answered, in case one was switched off meanwhile
+		s.cache.Set(cacheKey(req, fetched.providers()), resp)
+	}
+	return resp, nil
+}
+
+// metadata summarises a search. Providers skipped by an open circuit breaker are not
+// counted as queried.
+func (s *AggregatorService) metadata(total int, fetched fetchResult, start time.Time) models.Metadata {
+	skipped := fetched.skipped()
+	queried := len(fetched.statuses) - len(skipped)
+	return models.Metadata{
+		TotalResults:       total,
+		ProvidersQueried:   queried,
+		ProvidersSucceeded: fetched.succeeded(),
+		ProvidersFailed:    queried - fetched.succeeded(),
+		ProvidersSkipped:   skipped,
+		Partial:            fetched.partial,
+		Providers:          fetched.statuses,
+		SearchTimeMs:       time.Since(start).Milliseconds(),
+		CacheHit:           false,
+	}
+}
+
+// pipeline turns raw provider results into the final flight list.
+// Durations are derived first so the duration filters see total trip time.
+func (s *AggregatorService) pipeline(flights []models.Flight, req models.SearchRequest) ([]models.Flight, error) {
+	if err := s.calcDurations(flights); err != nil {
+		return nil, err
+	}
+	flights = s.interlineFlights(flights, req)
+	filtered, err := s.filterFlights(flights, req)
+	if err != nil {
+		return nil, err
+	}
 	unique, err := s.comparePrices(filtered)
 	if err != nil {
-		return models.SearchResponse{
-			SearchCriteria: req,
-			Metadata: models.Metadata{
-				TotalResults:       0,
-				ProvidersQueried:   len(s.providers),
-				ProvidersSucceeded: successCount,
-				ProvidersFailed:    len(s.providers) - successCount,
-				SearchTimeMs:       time.Since(start).Milliseconds(),
-				CacheHit:           false,
-			},
-			Flights: nil,
-		}, err
+		return nil, err
 	}
+	if err := s.rankFlights(unique); err != nil {
+		return nil, err
+	}
+	return s.sortFlights(unique, req)
+}
 
-	err = s.calcDurations(unique)
-	if err != nil {
-		return models.SearchResponse{
-			SearchCriteria: req,
-			Metadata: models.Metadata{
-				TotalResults:       0,
-				ProvidersQueried:   len(s.providers),
-				ProvidersSucceeded: successCount,
-				ProvidersFailed:    len(s.providers) - successCount,
-				SearchTimeMs:       time.Since(start).Milliseconds(),
-				CacheHit:           false,
-			},
-			Flights: nil,
-		}, err
+// fetchResult collects what the providers returned for one search.
+type fetchResult struct {
+	flights  []models.Flight
+	statuses []models.ProviderStatus // one per configured provider, in provider order
+	partial  bool                    // some providers were cut off by the soft deadline
+}
+
+func (r fetchResult) succeeded() int {
+	n := 0
+	for _, st := range r.statuses {
+		if st.Status == models.ProviderOK {
+			n++
+		}
 	}
+	return n
+}
 
-	err = s.rankFlights(unique)
-	if err != nil {
-		return models.SearchResponse{
-			SearchCriteria: req,
-			Metadata: models.Metadata{
-				TotalResults:       0,
-				ProvidersQueried:   len(s.providers),
-				ProvidersSucceeded: successCount,
-				ProvidersFailed:    len(s.providers) - successCount,
-				SearchTimeMs:       time.Since(start).Milliseconds(),
-				CacheHit:           false,
-			},
-			Flights: nil,
-		}, err
+// complete reports whether every provider answered, so the response can be cached as
+// a whole. Anything less is rebuilt on the next search from the provider cache, which
+// only calls the providers that are missing.
+func (r fetchResult) complete() bool {
+	return !r.partial && r.succeeded() == len(r.statuses)
+}
+
+// providers lists the names of the providers queried.
+func (r fetchResult) providers() []string {
+	names := make([]string, len(r.statuses))
+	for i, st := range r.statuses {
+		names[i] = st.Name
 	}
+	return names
+}
 
-	sorted, err := s.sortFlights(unique, req)
-	if err != nil {
-		return models.SearchResponse{
-			SearchCriteria: req,
-			Metadata: models.Metadata{
-				TotalResults:       0,
-				ProvidersQueried:   len(s.providers),
-				ProvidersSucceeded: successCount,
-				ProvidersFailed:    len(s.providers) - successCount,
-				SearchTimeMs:       time.Since(start).Milliseconds(),
-				CacheHit:           false,
-			},
-			Flights: nil,
-		}, err
+// skipped lists the providers whose circuit breaker was open.
+func (r fetchResult) skipped() []string {
+	var names []string
+	for _, st := range r.statuses {
+		if st.Status == models.ProviderSkipped {
+			names = append(names, st.Name)
+		}
 	}
+	return names
+}
 
-	resp = models.SearchResponse{
-		SearchCriteria: req,
-		Metadata: models.Metadata{
-			TotalResults:       len(sorted),
-			ProvidersQueried:   len(s.providers),
-			ProvidersSucceeded: successCount,
-			ProvidersFailed:    len(s.providers) - successCount,
-			SearchTimeMs:       time.Since(start).Milliseconds(),
-			CacheHit:           false,
-		},
-		Flights: sorted,
-	}
-	aggCache.Set(key, resp)
-	return resp, nil
+// fetchErr decides whether a fetch produced anything worth returning.
+func (s *AggregatorService) fetchErr(ctx context.Context, fetched fetchResult) error {
+	succeeded := fetched.succeeded()
+	switch {
+	case fetched.partial && succeeded > 0:
+		// Best available results, the stragglers are reported in the metadata
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case fetched.partial:
+		return errSoftDeadline
+	case len(fetched.statuses) > 0 && succeeded == 0:
+		// Nothing to aggregate when every provider failed
+		return ErrAllProvidersFailed
+	}
+	return nil
 }
 
 // Concurrent provider calls
-func (s *AggregatorService) fetchFromProviders(ctx context.Context, req models.SearchRequest) ([]models.Flight, int, error) {
-	resultsChan := make(chan []models.Flight, len(s.providers))
-	var successCount int
-	var failedCount int
-
-	done := make(chan struct{})
-
-	for _, p := range s.providers {
-		go func(prov providers.Provider) {
-			var flights []models.Flight
-			var err error
-			retries := 2
-			for i := 0; i <= retries; i++ {
-				flights, err = prov.FetchFlights(ctx, req)
-				if err == nil {
-					break
-				}
-				time.Sleep(time.Duration(100*(i+1)) * time.Millisecond)
+func (s *AggregatorService) fetchFromProviders(ctx context.Context, provs []providers.Provider, req models.SearchRequest) (fetchResult, error) {
+	if s.softDeadline.Budget > 0 {
+		return s.fetchWithSoftDeadline(ctx, provs, req), nil
+	}
+	c := newCollector(provs)
+	for res := range s.queryProviders(ctx, provs, req) {
+		c.add(res)
+	}
+	return c.result(), nil
+}
+
+// collector gathers provider results in provider order. Providers that have not
+// answered yet have a status with only their name set.
+type collector struct {
+	flights  [][]models.Flight
+	statuses []models.ProviderStatus
+}
+
+func newCollector(provs []providers.Provider) *collector {
+	c := &collector{flights: make([][]models.Flight, len(provs)), statuses: make([]models.ProviderStatus, len(provs))}
+	for i, p := range provs {
+		c.statuses[i].Name = p.Name()
+	}
+	return c
+}
+
+func (c *collector) add(res providerResult) {
+	c.flights[res.index] = res.flights
+	c.statuses[res.index] = res.status
+}
+
+// result copies out what has been collected so far.
+func (c *collector) result() fetchResult {
+	var flights []models.Flight
+	for _, fl := range c.flights {
+		flights = append(flights, fl...)
+	}
+	return fetchResult{flights: flights, statuses: append([]models.ProviderStatus(nil), c.statuses...)}
+}
+
+// providerResult is the outcome of querying a single provider.
+type providerResult struct {
+	index   int // position in the queried providers
+	status  models.ProviderStatus
+	flights []models.Flight
+}
+
+// providerTask is one provider asked for one search.
+type providerTask struct {
+	prov providers.Provider
+	req  models.SearchRequest
+}
+
+// queryProviders queries every provider concurrently, at most maxParallelFetches at a
+// time, and delivers each outcome as soon as it is known. Providers with cached flights
+// for the route answer from the cache without a call. A provider that panics is
+// reported as failed. The channel has room for every provider so nothing blocks if the
+// caller stops reading, and it is closed once all have answered.
+func (s *AggregatorService) queryProviders(ctx context.Context, provs []providers.Provider, req models.SearchRequest) <-chan providerResult {
+	tasks := make([]providerTask, len(provs))
+	for i, p := range provs {
+		tasks[i] = providerTask{prov: p, req: req}
+	}
+	return s.queryTasks(ctx, tasks)
+}
+
+// queryTasks is queryProviders for tasks that may ask different providers different
+// searches. Results are indexed by task.
+func (s *AggregatorService) queryTasks(ctx context.Context, tasks []providerTask) <-chan providerResult {
+	ctx = s.withFetchSlots(ctx)
+	breakers := make([]*circuitBreaker, len(tasks))
+	allowed := make([]bool, len(tasks))
+	cached := make([][]models.Flight, len(tasks))
+	hit := make([]bool, len(tasks))
+	for i, t := range tasks {
+		if cached[i], hit[i] = s.providerCache.get(t.prov.Name(), t.req); hit[i] {
+			continue
+		}
+		breakers[i] = s.breaker(t.prov.Name())
+		allowed[i] = breakers[i].allow()
+	}
+
+	runs := fanout.Run(ctx, len(tasks), s.maxParallelFetches, func(ctx context.Context, i int) (providerResult, error) {
+		prov, req := tasks[i].prov, tasks[i].req
+		if hit[i] {
+			return providerResult{index: i, flights: cached[i], status: models.ProviderStatus{
+				Name: prov.Name(), Status: models.ProviderOK, FlightCount: len(cached[i]), Cached: true,
+			}}, nil
+		}
+		if !allowed[i] {
+			return providerResult{index: i, status: models.ProviderStatus{
+				Name: prov.Name(), Status: models.ProviderSkipped, ErrorCode: models.ErrorCodeCircuitOpen,
+			}}, nil
+		}
+		st, flights := s.queryProvider(ctx, prov, breakers[i], routeRequests(req))
+		if st.Status == models.ProviderOK && st.ErrorCode == "" {
+			s.providerCache.set(prov.Name(), req, flights)
+		}
+		return providerResult{index: i, status: st, flights: flights}, nil
+	})
+
+	results := make(chan providerResult, len(tasks))
+	go func() {
+		defer close(results)
+		for t := range runs {
+			if t.Err == nil {
+				results <- t.Value
+				continue
 			}
-			if err == nil {
-				resultsChan <- flights
-				successCount++
-			} else {
-				failedCount++
+			// The provider panicked or never got a slot before the search ended
+			name := tasks[t.Index].prov.Name()
+			var panicErr *fanout.PanicError
+			switch {
+			case errors.As(t.Err, &panicErr):
+				log.Printf("provider %s panicked: %v\n%s", name, panicErr.Value, panicErr.Stack)
+				breakers[t.Index].record(t.Err)
+			case !hit[t.Index] && allowed[t.Index]:
+				breakers[t.Index].release()
 			}
-			done <- struct{}{}
-		}(p)
+			results <- providerResult{index: t.Index, status: models.ProviderStatus{
+				Name:      name,
+				Status:    models.ProviderFailed,
+				LatencyMs: t.Elapsed.Milliseconds(),
+				ErrorCode: classifyError(t.Err),
+				Error:     t.Err.Error(),
+			}}
+		}
+	}()
+	return results
+}
+
+// queryProvider fetches every route from one provider and feeds the outcome to its breaker.
+func (s *AggregatorService) queryProvider(ctx context.Context, prov providers.Provider, cb *circuitBreaker, routes []models.SearchRequest) (models.ProviderStatus, []models.Flight) {
+	start := time.Now()
+	flights, attempts, err := s.fetchRoutes(ctx, prov, routes)
+	kind, _ := providers.KindOf(err)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// The search was cut short, which says nothing about the provider
+		cb.release()
+	case kind == providers.KindBadRequest || kind == providers.KindNoAvailability:
+		// The provider answered, it just had nothing for this search
+		cb.record(nil)
+	default:
+		cb.record(err)
 	}
 
-	// Wait for all goroutines
-	for i := 0; i < len(s.providers); i++ {
-		<-done
+	st := models.ProviderStatus{
+		Name:      prov.Name(),
+		Status:    models.ProviderOK,
+		Attempts:  attempts,
+		LatencyMs: time.Since(start).Milliseconds(),
 	}
-	close(resultsChan)
+	if err != nil {
+		st.ErrorCode = classifyError(err)
+		st.Error = err.Error()
+		if kind != providers.KindNoAvailability {
+			st.Status = models.ProviderFailed
+		}
+		return st, nil
+	}
+	st.FlightCount = len(flights)
+	return st, flights
+}
 
-	var allFlights []models.Flight
-	for fList := range resultsChan {
-		allFlights = append(allFlights, fList...)
+// errorCodes maps classified provider errors to the codes reported in the metadata.
+var errorCodes = map[providers.ErrorKind]string{
+	providers.KindUnavailable:       models.ErrorCodeUnavailable,
+	providers.KindRateLimited:       models.ErrorCodeRateLimited,
+	providers.KindBadRequest:        models.ErrorCodeBadRequest,
+	providers.KindNoAvailability:    models.ErrorCodeNoAvailability,
+	providers.KindAuth:              models.ErrorCodeAuthFailed,
+	providers.KindMalformedResponse: models.ErrorCodeMalformedResponse,
+}
+
+// classifyError maps a provider failure to the error code reported in the metadata.
+func classifyError(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	kind, _ := providers.KindOf(err)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return models.ErrorCodeTimeout
+	case errors.Is(err, context.Canceled):
+		return models.ErrorCodeCanceled
+	case errorCodes[kind] != "":
+		return errorCodes[kind]
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return models.ErrorCodeMalformedResponse
+	default:
+		return models.ErrorCodeProviderError
 	}
+}
+
+// routeRequests expands city codes into one request per airport pair.
+func routeRequests(req models.SearchRequest) []models.SearchRequest {
+	var reqs []models.SearchRequest
+	for _, origin := range airports.Expand(req.Origin) {
+		for _, dest := range airports.Expand(req.Destination) {
+			r := req
+			r.Origin, r.Destination = origin, dest
+			reqs = append(reqs, r)
+		}
+	}
+	return reqs
+}
+
+// fetchRoutes queries one provider for every airport pair concurrently, each call
+// taking one of the search's fetch slots. The provider succeeds when at least one pair
+// answered. Attempts are summed over all pairs.
+func (s *AggregatorService) fetchRoutes(ctx context.Context, prov providers.Provider, routes []models.SearchRequest) ([]models.Flight, int, error) {
+	if len(routes) == 1 {
+		return s.fetchWithRetry(ctx, prov, routes[0])
+	}
+
+	type routeResult struct {
+		flights  []models.Flight
+		attempts int
+	}
+	results := fanout.Run(ctx, len(routes), 0, func(ctx context.Context, i int) (routeResult, error) {
+		flights, attempts, err := s.fetchWithRetry(ctx, prov, routes[i])
+		return routeResult{flights: flights, attempts: attempts}, err
+	})
 
-	return allFlights, successCount, nil
+	var flights []models.Flight
+	var lastErr error
+	attempts := 0
+	succeeded := false
+	for res := range results {
+		attempts += res.Value.attempts
+		if res.Err != nil {
+			lastErr = res.Err
+			continue
+		}
+		succeeded = true
+		flights = append(flights, res.Value.flights...)
+	}
+	if !succeeded {
+		return nil, attempts, lastErr
+	}
+	return flights, attempts, nil
 }
 
 // Filtering
 func (s *AggregatorService) filterFlights(flights []models.Flight, req models.SearchRequest) ([]models.Flight, error) {
 	var filtered []models.Flight
 	for _, f := range flights {
-		if f.Departure.Airport != req.Origin || f.Arrival.Airport != req.Destination {
+		if !airports.Matches(req.Origin, f.Departure.Airport) || !airports.Matches(req.Destination, f.Arrival.Airport) {
+			continue
+		}
+		// Datetime carries the local departure date in its first 10 characters
+		if req.DepartureDate != "" && !strings.HasPrefix(f.Departure.Datetime, req.DepartureDate) {
 			continue
 		}
 		if req.MinPrice != nil && f.Price.Amount < *req.MinPrice {
@@ -296,6 +590,11 @@ func (s *AggregatorService) comparePrices(flights []models.Flight) ([]models.Fli
 func (s *AggregatorService) calcDurations(flights []models.Flight) error {
 	for i := range flights {
 		f := &flights[i]
+		if dur, ok := segmentsDuration(f.Segments, f.Layovers); ok {
+			f.Duration.TotalMinutes = dur
+			f.Duration.Formatted = fmt.Sprintf("%dh %dm", dur/60, dur%60)
+			continue
+		}
 		if f.Duration.TotalMinutes == 0 && f.Departure.Timestamp > 0 && f.Arrival.Timestamp > 0 {
 			dur := int((f.Arrival.Timestamp - f.Departure.Timestamp) / 60)
 			f.Duration.TotalMinutes = dur
@@ -305,6 +604,29 @@ func (s *AggregatorService) calcDurations(flights []models.Flight) error {
 	return nil
 }
 
+// segmentsDuration spans first departure to last arrival, falling back to
+// summing leg and layover minutes when segment timestamps are missing.
+func segmentsDuration(segments []models.Segment, layovers []models.Layover) (int, bool) {
+	if len(segments) == 0 {
+		return 0, false
+	}
+	first, last := segments[0].Departure, segments[len(segments)-1].Arrival
+	if first.Timestamp > 0 && last.Timestamp > first.Timestamp {
+		return int((last.Timestamp - first.Timestamp) / 60), true
+	}
+	total := 0
+	for _, seg := range segments {
+		if seg.Duration.TotalMinutes == 0 {
+			return 0, false
+		}
+		total += seg.Duration.TotalMinutes
+	}
+	for _, l := range layovers {
+		total += l.DurationMinutes
+	}
+	return total, true
+}
+
 // Ranking (best value)
 func (s *AggregatorService) rankFlights(flights []models.Flight) error {
 	bestValue := func(f models.Flight) int {
@@ -2,12 +2,115 @@ package aggregator
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flight-aggregator/models"
 	"flight-aggregator/providers"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// stubProvider returns a fixed flight list regardless of the request, after an optional delay.
+type stubProvider struct {
+	name    string
+	flights []models.Flight
+	err     error
+	delay   time.Duration
+}
+
+func (p *stubProvider) Name() string { return p.name }
+func (p *stubProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	if p.delay > 0 {
+		select {
+		case <-time.After(p.delay):
+		case <-ctx.Done():
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.flights, p.err
+}
+
+// routeProvider only answers with flights departing the requested origin, after an optional delay.
+type routeProvider struct {
+	name    string
+	flights []models.Flight
+	delay   time.Duration
+	mu      sync.Mutex
+	origins []string
+}
+
+func (p *routeProvider) Name() string { return p.name }
+func (p *routeProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	p.mu.Lock()
+	p.origins = append(p.origins, req.Origin)
+	p.mu.Unlock()
+	if p.delay > 0 {
+		select {
+		case <-time.After(p.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var out []models.Flight
+	for _, f := range p.flights {
+		if f.Departure.Airport == req.Origin && f.Arrival.Airport == req.Destination {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// scriptedProvider returns its errors in order, then its flights once they run out.
+type scriptedProvider struct {
+	name    string
+	flights []models.Flight
+	mu      sync.Mutex
+	errs    []error
+	calls   int
+}
+
+func (p *scriptedProvider) Name() string { return p.name }
+func (p *scriptedProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return nil, err
+	}
+	return p.flights, nil
+}
+
+var wib = time.FixedZone("WIB", 7*3600)
+
+func testFlight(code, number, from, to string, dep time.Time, mins, price int) models.Flight {
+	arr := dep.Add(time.Duration(mins) * time.Minute)
+	return models.Flight{
+		ID:           number + "_" + code,
+		Provider:     code,
+		Airline:      models.Airline{Name: code, Code: code},
+		FlightNumber: number,
+		Departure:    models.Event{Airport: from, Datetime: dep.Format(time.RFC3339), Timestamp: dep.Unix()},
+		Arrival:      models.Event{Airport: to, Datetime: arr.Format(time.RFC3339), Timestamp: arr.Unix()},
+		Duration:     models.Duration{TotalMinutes: mins},
+		Price:        models.Price{Amount: price, Currency: "IDR"},
+	}
+}
+
+// testClock pins "today" before the mock data departure date.
+var testClock = WithClock(func() time.Time {
+	return time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+})
+
 func TestAggregatorService_Search_Basic(t *testing.T) {
 	provs := []providers.Provider{
 		&providers.GarudaProvider{},
@@ -15,7 +118,7 @@ func TestAggregatorService_Search_Basic(t *testing.T) {
 		&providers.LionAirProvider{},
 		&providers.BatikAirProvider{},
 	}
-	agg := NewAggregatorService(provs)
+	agg := NewAggregatorService(provs, testClock)
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
@@ -46,7 +149,7 @@ func TestAggregatorService_Search_Filters(t *testing.T) {
 		&providers.LionAirProvider{},
 		&providers.BatikAirProvider{},
 	}
-	agg := NewAggregatorService(provs)
+	agg := NewAggregatorService(provs, testClock)
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
@@ -96,7 +199,7 @@ func TestAggregatorService_Search_Cache(t *testing.T) {
 		&providers.LionAirProvider{},
 		&providers.BatikAirProvider{},
 	}
-	agg := NewAggregatorService(provs)
+	agg := NewAggregatorService(provs, testClock)
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
@@ -128,7 +231,7 @@ func TestAggregatorService_Search_ErrorHandling(t *testing.T) {
 	provs := []providers.Provider{
 		&providers.GarudaProvider{},
 	}
-	agg := NewAggregatorService(provs)
+	agg := NewAggregatorService(provs, testClock)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Microsecond) // force timeout
 	defer cancel()
 
@@ -145,3 +248,1736 @@ func TestAggregatorService_Search_ErrorHandling(t *testing.T) {
 		t.Log("expected context deadline exceeded error, got:", err)
 	}
 }
+
+func TestAggregatorService_Search_Validation(t *testing.T) {
+	agg := NewAggregatorService([]providers.Provider{&providers.GarudaProvider{}}, testClock)
+	minPrice, maxPrice := 900000, 500000
+	depStart, depEnd := "9:00", "12:00"
+
+	req := models.SearchRequest{
+		Origin:             "cgk",
+		Destination:        "",
+		DepartureDate:      "2025-11-30",
+		Passengers:         "two",
+		MinPrice:           &minPrice,
+		MaxPrice:           &maxPrice,
+		DepartureTimeStart: &depStart,
+		DepartureTimeEnd:   &depEnd,
+	}
+
+	_, err := agg.Search(context.Background(), req)
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected ErrInvalidRequest, got %v", err)
+	}
+	var verr *models.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *models.ValidationError, got %T", err)
+	}
+
+	want := map[string]string{
+		"origin":               models.CodeInvalidFormat,
+		"destination":          models.CodeRequired,
+		"departure_date":       models.CodeInPast,
+		"passengers":           models.CodeInvalidFormat,
+		"min_price":            models.CodeInvalidRange,
+		"departure_time_start": models.CodeInvalidFormat,
+	}
+	got := make(map[string]string)
+	for _, f := range verr.Fields {
+		got[f.Field] = f.Code
+	}
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("field %s: expected code %q, got %q", field, code, got[field])
+		}
+	}
+	if len(verr.Fields) != len(want) {
+		t.Errorf("expected %d field errors, got %+v", len(want), verr.Fields)
+	}
+}
+
+func TestAggregatorService_CalcDurations_Segments(t *testing.T) {
+	agg := NewAggregatorService(nil)
+	flights := []models.Flight{
+		{
+			// Top level only covers the first leg, segments cover the whole trip
+			Duration: models.Duration{TotalMinutes: 90},
+			Segments: []models.Segment{
+				{Departure: models.Event{Timestamp: 1765782000}, Arrival: models.Event{Timestamp: 1765787400}},
+				{Departure: models.Event{Timestamp: 1765793700}, Arrival: models.Event{Timestamp: 1765795500}},
+			},
+		},
+		{
+			Segments: []models.Segment{
+				{Duration: models.Duration{TotalMinutes: 60}},
+				{Duration: models.Duration{TotalMinutes: 45}},
+			},
+			Layovers: []models.Layover{{Airport: "SUB", DurationMinutes: 75}},
+		},
+	}
+	if err := agg.calcDurations(flights); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flights[0].Duration.TotalMinutes != 225 || flights[0].Duration.Formatted != "3h 45m" {
+		t.Errorf("expected 225 minutes from segment timestamps, got %+v", flights[0].Duration)
+	}
+	if flights[1].Duration.TotalMinutes != 180 {
+		t.Errorf("expected 180 minutes from legs plus layover, got %+v", flights[1].Duration)
+	}
+}
+
+func TestAggregatorService_SearchRoundTrip(t *testing.T) {
+	provs := []providers.Provider{
+		&stubProvider{name: "GA", flights: []models.Flight{
+			testFlight("GA", "GA400", "CGK", "DPS", time.Date(2025, 12, 15, 6, 0, 0, 0, wib), 110, 1200000),
+			testFlight("GA", "GA401", "DPS", "CGK", time.Date(2025, 12, 20, 10, 0, 0, 0, wib), 110, 1100000),
+		}},
+		&stubProvider{name: "JT", flights: []models.Flight{
+			testFlight("JT", "JT740", "CGK", "DPS", time.Date(2025, 12, 15, 5, 30, 0, 0, wib), 105, 900000),
+			testFlight("JT", "JT741", "DPS", "CGK", time.Date(2025, 12, 20, 18, 0, 0, 0, wib), 105, 800000),
+		}},
+	}
+	agg := NewAggregatorService(provs, testClock)
+	returnDate := "2025-12-20"
+	maxPrice := 2200000
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15", ReturnDate: &returnDate, MaxPrice: &maxPrice}
+
+	resp, err := agg.SearchRoundTrip(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Outbound) != 2 || len(resp.Inbound) != 2 {
+		t.Fatalf("expected both legs to keep 2 flights, got %d/%d", len(resp.Outbound), len(resp.Inbound))
+	}
+	// GA400+GA401 costs 2.3M and is dropped by the combined max price
+	if len(resp.Options) != 3 || resp.Metadata.TotalResults != 3 {
+		t.Fatalf("expected 3 combinations, got %+v", resp.Options)
+	}
+	best := resp.Options[0]
+	if best.Outbound.FlightNumber != "JT740" || best.Inbound.FlightNumber != "JT741" || !best.SameCarrier {
+		t.Errorf("expected cheapest same-carrier JT pair first, got %s", best.ID)
+	}
+	if best.TotalPrice.Amount != 1700000 || best.TotalDuration.TotalMinutes != 210 {
+		t.Errorf("unexpected totals: %+v %+v", best.TotalPrice, best.TotalDuration)
+	}
+	mixed := 0
+	for _, o := range resp.Options {
+		if !o.SameCarrier {
+			mixed++
+		}
+	}
+	if mixed != 2 {
+		t.Errorf("expected 2 mix-and-match options, got %d", mixed)
+	}
+}
+
+// hookProvider runs hook before answering with its flights for the requested route.
+type hookProvider struct {
+	routeProvider
+	hook func(req models.SearchRequest)
+}
+
+func (p *hookProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	p.hook(req)
+	return p.routeProvider.FetchFlights(ctx, req)
+}
+
+func TestAggregatorService_SearchRoundTrip_ProviderToggledMidSearch(t *testing.T) {
+	var agg *AggregatorService
+	toggled := make(chan struct{})
+	a := &hookProvider{
+		routeProvider: routeProvider{name: "A", flights: []models.Flight{
+			testFlight("GA", "GA400", "CGK", "DPS", time.Date(2025, 12, 15, 6, 0, 0, 0, wib), 110, 1200000),
+			testFlight("GA", "GA401", "DPS", "CGK", time.Date(2025, 12, 20, 10, 0, 0, 0, wib), 110, 1100000),
+		}},
+		hook: func(req models.SearchRequest) {
+			// Switch B off while the outbound leg is fetched, and hold the inbound leg until then
+			if req.Origin == "CGK" {
+				if err := agg.SetProviderEnabled("B", false); err != nil {
+					t.Error(err)
+				}
+				close(toggled)
+				return
+			}
+			<-toggled
+		},
+	}
+	b := &routeProvider{name: "B", flights: []models.Flight{
+		testFlight("JT", "JT740", "CGK", "DPS", time.Date(2025, 12, 15, 5, 30, 0, 0, wib), 105, 900000),
+		testFlight("JT", "JT741", "DPS", "CGK", time.Date(2025, 12, 20, 18, 0, 0, 0, wib), 105, 800000),
+	}}
+	agg = NewAggregatorService([]providers.Provider{a, b}, testClock)
+	returnDate := "2025-12-20"
+
+	resp, err := agg.SearchRoundTrip(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15", ReturnDate: &returnDate})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Both legs ask the providers enabled when the search started
+	if len(b.origins) != 2 || len(resp.Outbound) != 2 || len(resp.Inbound) != 2 {
+		t.Fatalf("expected B to answer both legs, got calls %v and %d/%d flights", b.origins, len(resp.Outbound), len(resp.Inbound))
+	}
+	sts := resp.Metadata.Providers
+	if len(sts) != 2 || sts[0].Name != "A" || sts[1].Name != "B" {
+		t.Fatalf("expected one status per provider, got %+v", sts)
+	}
+	for _, st := range sts {
+		if st.Status != models.ProviderOK || st.Attempts != 2 || st.FlightCount != 2 {
+			t.Errorf("expected %s to be merged over both legs, got %+v", st.Name, st)
+		}
+	}
+}
+
+func TestMergeFetches_MatchesProvidersByName(t *testing.T) {
+	leg := func(statuses ...models.ProviderStatus) legResult {
+		return legResult{fetched: fetchResult{statuses: statuses}}
+	}
+	merged := mergeFetches([]legResult{
+		leg(models.ProviderStatus{Name: "A", Status: models.ProviderOK, Attempts: 1, FlightCount: 2},
+			models.ProviderStatus{Name: "B", Status: models.ProviderOK, Attempts: 1, FlightCount: 1}),
+		leg(models.ProviderStatus{Name: "B", Status: models.ProviderFailed, Attempts: 3, ErrorCode: models.ErrorCodeTimeout},
+			models.ProviderStatus{Name: "A", Status: models.ProviderOK, Attempts: 1, FlightCount: 4}),
+	})
+	if len(merged.statuses) != 2 {
+		t.Fatalf("expected 2 statuses, got %+v", merged.statuses)
+	}
+	if a := merged.statuses[0]; a.Name != "A" || a.Status != models.ProviderOK || a.Attempts != 2 || a.FlightCount != 6 {
+		t.Errorf("unexpected merged A: %+v", a)
+	}
+	if b := merged.statuses[1]; b.Name != "B" || b.Status != models.ProviderFailed || b.Attempts != 4 || b.ErrorCode != models.ErrorCodeTimeout {
+		t.Errorf("unexpected merged B: %+v", b)
+	}
+}
+
+func TestAggregatorService_SearchRoundTrip_RequiresReturnDate(t *testing.T) {
+	agg := NewAggregatorService([]providers.Provider{&stubProvider{name: "GA"}}, testClock)
+	_, err := agg.SearchRoundTrip(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15"})
+	var verr *models.ValidationError
+	if !errors.As(err, &verr) || verr.Fields[0].Field != "returnDate" {
+		t.Fatalf("expected returnDate validation error, got %v", err)
+	}
+}
+
+func TestPairRoundTrips_KeepsBestOptions(t *testing.T) {
+	var outbound, inbound []models.Flight
+	for i := 0; i < 30; i++ {
+		dep := time.Date(2025, 12, 15, 6, 0, 0, 0, wib).Add(time.Duration(i*20) * time.Minute)
+		outbound = append(outbound, testFlight("GA", fmt.Sprintf("GA%d", i), "CGK", "DPS", dep, 100+i%7*10, 900000-i*7919%50000))
+		inbound = append(inbound, testFlight("JT", fmt.Sprintf("JT%d", i), "DPS", "CGK", dep.AddDate(0, 0, 3), 90+i%5*15, 800000-i*4733%60000))
+	}
+
+	for _, sortBy := range []string{"", "price_desc", "departure_asc", "duration_asc"} {
+		req := models.SearchRequest{SortBy: &sortBy}
+		got := pairRoundTrips(outbound, inbound, req)
+
+		// Every pairing, ranked the same way and cut afterwards
+		var all []models.RoundTripOption
+		var keys []comboKey
+		for _, out := range outbound {
+			for _, in := range inbound {
+				all = append(all, newRoundTripOption(out, in))
+				keys = append(keys, comboKey{
+					price:     out.Price.Amount + in.Price.Amount,
+					minutes:   out.Duration.TotalMinutes + in.Duration.TotalMinutes,
+					departure: out.Departure.Timestamp,
+					arrival:   in.Arrival.Timestamp,
+				})
+			}
+		}
+		less := comboLess(&sortBy)
+		order := make([]int, len(all))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool { return less(keys[order[i]], keys[order[j]]) })
+
+		if len(got) != maxRoundTripOptions {
+			t.Fatalf("sort %q: expected %d options, got %d", sortBy, maxRoundTripOptions, len(got))
+		}
+		for i, o := range got {
+			if want := all[order[i]].ID; o.ID != want {
+				t.Fatalf("sort %q: option %d is %s, expected %s", sortBy, i, o.ID, want)
+			}
+		}
+	}
+}
+
+func TestAggregatorService_SearchMultiCity(t *testing.T) {
+	provs := []providers.Provider{
+		&stubProvider{name: "GA", flights: []models.Flight{
+			testFlight("GA", "GA400", "CGK", "DPS", time.Date(2025, 12, 15, 6, 0, 0, 0, wib), 110, 1200000),
+			testFlight("GA", "GA340", "DPS", "SUB", time.Date(2025, 12, 17, 9, 0, 0, 0, wib), 60, 700000),
+		}},
+		&stubProvider{name: "JT", flights: []models.Flight{
+			testFlight("JT", "JT740", "CGK", "DPS", time.Date(2025, 12, 15, 5, 30, 0, 0, wib), 105, 900000),
+			testFlight("JT", "JT590", "SUB", "CGK", time.Date(2025, 12, 17, 11, 0, 0, 0, wib), 90, 500000),
+			// Leaves 30 minutes after GA340 lands, below the minimum connection
+			testFlight("JT", "JT592", "SUB", "CGK", time.Date(2025, 12, 17, 10, 30, 0, 0, wib), 90, 300000),
+		}},
+	}
+	agg := NewAggregatorService(provs, testClock)
+	minConnection := 60
+	req := models.MultiCityRequest{
+		Legs: []models.Leg{
+			{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15"},
+			{Origin: "DPS", Destination: "SUB", DepartureDate: "2025-12-17"},
+			{Origin: "SUB", Destination: "CGK", DepartureDate: "2025-12-17"},
+		},
+		Passengers:           "1",
+		MinConnectionMinutes: &minConnection,
+	}
+
+	resp, err := agg.SearchMultiCity(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Itineraries) != 2 {
+		t.Fatalf("expected 2 itineraries, got %+v", resp.Itineraries)
+	}
+	best := resp.Itineraries[0]
+	if len(best.Flights) != 3 || best.Flights[0].FlightNumber != "JT740" || best.Flights[2].FlightNumber != "JT590" {
+		t.Errorf("unexpected best itinerary %s", best.ID)
+	}
+	if best.TotalPrice.Amount != 2100000 || best.TotalDuration.TotalMinutes != 255 {
+		t.Errorf("unexpected totals: %+v %+v", best.TotalPrice, best.TotalDuration)
+	}
+	for _, it := range resp.Itineraries {
+		if it.Flights[2].FlightNumber == "JT592" {
+			t.Errorf("itinerary %s violates the minimum connection time", it.ID)
+		}
+	}
+}
+
+func TestAggregatorService_SearchMultiCity_BoundedCombinations(t *testing.T) {
+	route := []string{"CGK", "DPS", "SUB", "UPG", "KNO", "BPN", "CGK"}
+	day := time.Date(2025, 12, 10, 0, 0, 0, 0, wib)
+	p := &routeProvider{name: "GA"}
+	req := models.MultiCityRequest{Passengers: "1"}
+	for leg := 0; leg < 6; leg++ {
+		date := day.AddDate(0, 0, leg)
+		req.Legs = append(req.Legs, models.Leg{Origin: route[leg], Destination: route[leg+1], DepartureDate: date.Format("2006-01-02")})
+		for i := 0; i < 10; i++ {
+			p.flights = append(p.flights, testFlight("GA", fmt.Sprintf("GA%d%02d", leg, i), route[leg], route[leg+1],
+				date.Add(time.Duration(6+i)*time.Hour), 90, 500000+i*10000))
+		}
+	}
+	agg := NewAggregatorService([]providers.Provider{p}, testClock)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	resp, err := agg.SearchMultiCity(context.Background(), req)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Itineraries) != maxItineraries {
+		t.Fatalf("expected %d itineraries, got %d", maxItineraries, len(resp.Itineraries))
+	}
+	// The cheapest flight of every leg makes the best itinerary
+	if best := resp.Itineraries[0]; best.TotalPrice.Amount != 6*500000 {
+		t.Errorf("expected the cheapest itinerary first, got %s at %d", best.ID, best.TotalPrice.Amount)
+	}
+	for i := 1; i < len(resp.Itineraries); i++ {
+		if resp.Itineraries[i].TotalPrice.Amount < resp.Itineraries[i-1].TotalPrice.Amount {
+			t.Fatalf("itineraries out of order at %d", i)
+		}
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64<<20 {
+		t.Errorf("expected the search to stay bounded, it allocated %d MB", alloc>>20)
+	}
+}
+
+func TestCapCombinations(t *testing.T) {
+	candidates := make([][]models.Flight, 6)
+	for i := range candidates {
+		candidates[i] = make([]models.Flight, maxFlightsPerLeg)
+	}
+	capCombinations(candidates, maxCombinations)
+	product := 1
+	for _, c := range candidates {
+		product *= len(c)
+		if len(c) < 5 {
+			t.Errorf("expected legs to be trimmed evenly, got %d flights on a leg", len(c))
+		}
+	}
+	if product > maxCombinations {
+		t.Errorf("expected at most %d combinations, got %d", maxCombinations, product)
+	}
+}
+
+func TestMultiCityRequest_Validate(t *testing.T) {
+	req := models.MultiCityRequest{
+		Legs: []models.Leg{
+			{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-17"},
+			{Origin: "dps", Destination: "SUB", DepartureDate: "2025-12-15"},
+		},
+		Passengers: "x",
+	}
+	err := req.Validate(time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC))
+	var verr *models.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	got := make(map[string]string)
+	for _, f := range verr.Fields {
+		got[f.Field] = f.Code
+	}
+	if got["legs[1].origin"] != models.CodeInvalidFormat || got["legs[1].departure_date"] != models.CodeInvalidRange || got["passengers"] != models.CodeInvalidFormat {
+		t.Errorf("unexpected field errors: %+v", verr.Fields)
+	}
+	if len(verr.Fields) != 3 {
+		t.Errorf("expected shared passengers error reported once, got %+v", verr.Fields)
+	}
+}
+
+func TestAggregatorService_Search_Interlining(t *testing.T) {
+	jt := testFlight("JT", "JT590", "CGK", "SUB", time.Date(2025, 12, 15, 6, 0, 0, 0, wib), 90, 600000)
+	jt.AvailableSeats = 40
+	id := testFlight("ID", "ID6380", "SUB", "DPS", time.Date(2025, 12, 15, 9, 0, 0, 0, wib), 60, 500000)
+	id.AvailableSeats = 12
+	// Leaves SUB 30 minutes after JT590 lands, too short for the SUB rule below
+	tight := testFlight("ID", "ID6370", "SUB", "DPS", time.Date(2025, 12, 15, 8, 0, 0, 0, wib), 60, 400000)
+
+	// Providers only answer the route they are asked for, so the hub legs must be requested
+	lion := &routeProvider{name: "Lion Air", flights: []models.Flight{jt}}
+	batik := &routeProvider{name: "Batik Air", flights: []models.Flight{id, tight}}
+	provs := []providers.Provider{lion, batik}
+	cfg := DefaultInterlineConfig()
+	cfg.Airports = map[string]ConnectionRule{"SUB": {Min: time.Hour, Max: 4 * time.Hour}}
+	agg := NewAggregatorService(provs, testClock, WithInterlining(cfg))
+
+	resp, err := agg.Search(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15", Passengers: "3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Flights) != 1 {
+		t.Fatalf("expected one stitched connection, got %+v", resp.Flights)
+	}
+	f := resp.Flights[0]
+	if !f.SelfTransfer || f.FlightNumber != "JT590/ID6380" || f.Provider != "JT + ID" {
+		t.Errorf("unexpected connection: %+v", f)
+	}
+	if f.Stops != 1 || f.Price.Amount != 1100000 || f.AvailableSeats != 12 || f.Duration.TotalMinutes != 240 {
+		t.Errorf("unexpected connection totals: stops=%d price=%d seats=%d duration=%d", f.Stops, f.Price.Amount, f.AvailableSeats, f.Duration.TotalMinutes)
+	}
+	if len(f.Layovers) != 1 || f.Layovers[0].Airport != "SUB" || f.Layovers[0].DurationMinutes != 90 {
+		t.Errorf("unexpected layovers: %+v", f.Layovers)
+	}
+	if !slicesContain(batik.origins, "SUB") {
+		t.Errorf("expected the SUB→DPS leg to be requested, got origins %v", batik.origins)
+	}
+
+	// A route with direct service is left alone, without fetching any hub legs
+	direct := testFlight("GA", "GA400", "CGK", "DPS", time.Date(2025, 12, 15, 6, 0, 0, 0, wib), 110, 1200000)
+	garuda := &routeProvider{name: "Garuda", flights: []models.Flight{direct}}
+	agg = NewAggregatorService([]providers.Provider{&routeProvider{name: "Lion Air", flights: []models.Flight{jt}}, garuda}, testClock, WithInterlining(cfg))
+	resp, err = agg.Search(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15", Passengers: "4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Flights) != 1 || resp.Flights[0].SelfTransfer {
+		t.Errorf("expected only the direct flight, got %+v", resp.Flights)
+	}
+	if len(garuda.origins) != 1 {
+		t.Errorf("expected only the requested route to be fetched, got origins %v", garuda.origins)
+	}
+
+	// Without hubs nothing is stitched
+	cfg.Hubs = nil
+	agg = NewAggregatorService([]providers.Provider{&routeProvider{name: "Lion Air", flights: []models.Flight{jt}}, &routeProvider{name: "Batik Air", flights: []models.Flight{id}}}, testClock, WithInterlining(cfg))
+	resp, err = agg.Search(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Flights) != 0 {
+		t.Errorf("expected no connections without hubs, got %+v", resp.Flights)
+	}
+}
+
+func TestAggregatorService_Search_InterliningWithinSoftDeadline(t *testing.T) {
+	prov := &routeProvider{name: "Slow", delay: 150 * time.Millisecond}
+	budget := 200 * time.Millisecond
+	agg := NewAggregatorService([]providers.Provider{prov}, testClock, WithSoftDeadline(SoftDeadline{Budget: budget}))
+
+	start := time.Now()
+	resp, err := agg.Search(context.Background(), models.SearchRequest{Origin: "SOC", Destination: "LOP", DepartureDate: "2025-12-15"})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The hub legs get what is left of the budget, not a budget of their own
+	if elapsed > budget+100*time.Millisecond {
+		t.Errorf("expected the search to finish within the %v budget, took %v", budget, elapsed)
+	}
+	st := resp.Metadata.Providers[0]
+	if st.Attempts != 1 || st.HubAttempts == 0 {
+		t.Errorf("expected the hub leg calls to be reported apart from the route's, got %+v", st)
+	}
+	if h := agg.ProviderHealth()[0]; h.ConsecutiveFailures != 0 {
+		t.Errorf("hub legs cut off by the budget should not count against the breaker: %+v", h)
+	}
+}
+
+func slicesContain(items []string, want string) bool {
+	for _, item := range items {
+		if item == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAggregatorService_SearchFlexible(t *testing.T) {
+	provs := []providers.Provider{
+		&stubProvider{name: "GA", flights: []models.Flight{
+			testFlight("GA", "GA400", "CGK", "DPS", time.Date(2025, 12, 15, 6, 0, 0, 0, wib), 110, 1200000),
+			testFlight("GA", "GA400", "CGK", "DPS", time.Date(2025, 12, 16, 6, 0, 0, 0, wib), 110, 1000000),
+		}},
+		&stubProvider{name: "JT", flights: []models.Flight{
+			testFlight("JT", "JT740", "CGK", "DPS", time.Date(2025, 12, 14, 5, 30, 0, 0, wib), 105, 700000),
+			testFlight("JT", "JT740", "CGK", "DPS", time.Date(2025, 12, 15, 5, 30, 0, 0, wib), 105, 900000),
+		}},
+	}
+	agg := NewAggregatorService(provs, testClock, WithMaxParallelFetches(2))
+	flex := 2
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15", Passengers: "1", FlexDays: &flex}
+
+	resp, err := agg.SearchFlexible(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Calendar) != 5 {
+		t.Fatalf("expected 5 calendar days, got %+v", resp.Calendar)
+	}
+	want := map[string]struct {
+		price, count int
+		airline      string
+	}{
+		"2025-12-13": {0, 0, ""},
+		"2025-12-14": {700000, 1, "JT"},
+		"2025-12-15": {900000, 2, "JT"},
+		"2025-12-16": {1000000, 1, "GA"},
+		"2025-12-17": {0, 0, ""},
+	}
+	for _, day := range resp.Calendar {
+		w := want[day.Date]
+		price := 0
+		if day.CheapestPrice != nil {
+			price = day.CheapestPrice.Amount
+		}
+		if price != w.price || day.FlightCount != w.count || day.CheapestAirline != w.airline {
+			t.Errorf("%s: got price=%d count=%d airline=%q, want %+v", day.Date, price, day.FlightCount, day.CheapestAirline, w)
+		}
+		if day.Selected != (day.Date == "2025-12-15") {
+			t.Errorf("%s: unexpected selected flag", day.Date)
+		}
+		if day.Status != models.DayOK {
+			t.Errorf("%s: unexpected status %q", day.Date, day.Status)
+		}
+	}
+	if len(resp.Flights) != 2 || resp.Metadata.TotalResults != 2 {
+		t.Errorf("expected the selected date's 2 flights, got %+v", resp.Flights)
+	}
+
+	// Days before today are left out of the calendar
+	agg = NewAggregatorService(provs, WithClock(func() time.Time { return time.Date(2025, 12, 14, 12, 0, 0, 0, time.UTC) }))
+	resp, err = agg.SearchFlexible(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Calendar) != 4 || resp.Calendar[0].Date != "2025-12-14" {
+		t.Errorf("expected calendar to start today, got %+v", resp.Calendar)
+	}
+}
+
+// dateProvider fails on one departure date and returns its flights on every other.
+type dateProvider struct {
+	name     string
+	flights  []models.Flight
+	failDate string
+}
+
+func (p *dateProvider) Name() string { return p.name }
+func (p *dateProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	if req.DepartureDate == p.failDate {
+		return nil, providers.Errorf(providers.KindUnavailable, "down for %s", req.DepartureDate)
+	}
+	return p.flights, nil
+}
+
+func TestAggregatorService_SearchFlexible_FailedDay(t *testing.T) {
+	prov := &dateProvider{name: "GA", failDate: "2025-12-16", flights: []models.Flight{
+		testFlight("GA", "GA400", "CGK", "DPS", time.Date(2025, 12, 15, 6, 0, 0, 0, wib), 110, 1200000),
+	}}
+	agg := NewAggregatorService([]providers.Provider{prov}, testClock, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	flex := 1
+	resp, err := agg.SearchFlexible(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15", FlexDays: &flex})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Calendar) != 3 {
+		t.Fatalf("expected 3 calendar days, got %+v", resp.Calendar)
+	}
+	// An empty day and a failed day both have no flights, only the status tells them apart
+	if day := resp.Calendar[0]; day.Status != models.DayOK || day.FlightCount != 0 {
+		t.Errorf("expected an empty but successful day, got %+v", day)
+	}
+	if day := resp.Calendar[1]; day.Status != models.DayOK || day.FlightCount != 1 {
+		t.Errorf("expected the selected day to succeed, got %+v", day)
+	}
+	day := resp.Calendar[2]
+	if day.Status != models.DayFailed || day.ErrorCode != models.ErrorCodeProviderError || day.Error == "" || day.CheapestPrice != nil {
+		t.Errorf("expected the failed day to be marked, got %+v", day)
+	}
+}
+
+// peakProvider records the most calls it had in flight at once, across all its instances.
+type peakProvider struct {
+	name    string
+	flights []models.Flight
+	peak    *peakCounter
+}
+
+type peakCounter struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+	calls    int
+}
+
+func (p *peakProvider) Name() string { return p.name }
+func (p *peakProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	p.peak.mu.Lock()
+	p.peak.calls++
+	p.peak.inFlight++
+	if p.peak.inFlight > p.peak.max {
+		p.peak.max = p.peak.inFlight
+	}
+	p.peak.mu.Unlock()
+	defer func() {
+		p.peak.mu.Lock()
+		p.peak.inFlight--
+		p.peak.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(10 * time.Millisecond):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var out []models.Flight
+	for _, f := range p.flights {
+		if f.Departure.Airport == req.Origin && f.Arrival.Airport == req.Destination && f.Departure.Datetime[:10] == req.DepartureDate {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+func TestAggregatorService_SearchFlexible_BoundsProviderCalls(t *testing.T) {
+	peak := &peakCounter{}
+	var provs []providers.Provider
+	for _, code := range []string{"GA", "JT", "QZ", "ID"} {
+		var flights []models.Flight
+		for d := 12; d <= 18; d++ {
+			flights = append(flights, testFlight(code, code+"400", "CGK", "DPS", time.Date(2025, 12, d, 6, 0, 0, 0, wib), 110, 1000000))
+		}
+		provs = append(provs, &peakProvider{name: code, flights: flights, peak: peak})
+	}
+	agg := NewAggregatorService(provs, testClock, WithMaxParallelFetches(8))
+	flex := 3
+
+	// 7 dates, 4 providers and 2 Jakarta airports make 56 calls that all have to share 8 slots
+	resp, err := agg.SearchFlexible(context.Background(), models.SearchRequest{Origin: "JKT", Destination: "DPS", DepartureDate: "2025-12-15", FlexDays: &flex})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Calendar) != 7 || len(resp.Flights) != 4 {
+		t.Fatalf("expected 7 days and 4 flights, got %d days and %+v", len(resp.Calendar), resp.Flights)
+	}
+	if peak.calls != 56 {
+		t.Errorf("expected 56 provider calls, got %d", peak.calls)
+	}
+	if peak.max > 8 {
+		t.Errorf("expected at most 8 provider calls in flight, got %d", peak.max)
+	}
+}
+
+func TestAggregatorService_Search_CityCode(t *testing.T) {
+	prov := &routeProvider{name: "GA", flights: []models.Flight{
+		testFlight("GA", "GA400", "CGK", "DPS", time.Date(2025, 12, 15, 6, 0, 0, 0, wib), 110, 1200000),
+		testFlight("GA", "GA7010", "HLP", "DPS", time.Date(2025, 12, 15, 8, 0, 0, 0, wib), 115, 1000000),
+		testFlight("GA", "GA200", "SUB", "DPS", time.Date(2025, 12, 15, 9, 0, 0, 0, wib), 60, 700000),
+	}}
+	agg := NewAggregatorService([]providers.Provider{prov}, testClock)
+
+	resp, err := agg.Search(context.Background(), models.SearchRequest{Origin: "JKT", Destination: "DPS", DepartureDate: "2025-12-15", Passengers: "2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sort.Strings(prov.origins)
+	if len(prov.origins) != 2 || prov.origins[0] != "CGK" || prov.origins[1] != "HLP" {
+		t.Errorf("expected fan-out to CGK and HLP, got %v", prov.origins)
+	}
+	got := make(map[string]bool)
+	for _, f := range resp.Flights {
+		got[f.FlightNumber] = true
+	}
+	if len(resp.Flights) != 2 || !got["GA400"] || !got["GA7010"] {
+		t.Errorf("expected flights from both Jakarta airports, got %+v", resp.Flights)
+	}
+}
+
+func TestAggregatorService_Search_CircuitBreaker(t *testing.T) {
+	dep := time.Date(2025, 12, 23, 8, 0, 0, 0, wib)
+	healthy := &stubProvider{name: "Healthy", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	flaky := &stubProvider{name: "Flaky", err: errors.New("503")}
+	agg := NewAggregatorService([]providers.Provider{healthy, flaky}, testClock,
+		WithCircuitBreaker(BreakerConfig{FailureThreshold: 2, Cooldown: 50 * time.Millisecond, HalfOpenSuccesses: 1}))
+
+	search := func(passengers string) models.Metadata {
+		t.Helper()
+		resp, err := agg.Search(context.Background(), models.SearchRequest{
+			Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-23", Passengers: passengers,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp.Metadata
+	}
+	state := func() string {
+		for _, h := range agg.ProviderHealth() {
+			if h.Name == "Flaky" {
+				return h.State
+			}
+		}
+		return ""
+	}
+
+	search("1")
+	if state() != BreakerClosed {
+		t.Fatalf("expected breaker closed after one failure, got %s", state())
+	}
+	search("2")
+	if state() != BreakerOpen {
+		t.Fatalf("expected breaker open after two failures, got %s", state())
+	}
+
+	meta := search("3")
+	if len(meta.ProvidersSkipped) != 1 || meta.ProvidersSkipped[0] != "Flaky" {
+		t.Fatalf("expected Flaky skipped, got %v", meta.ProvidersSkipped)
+	}
+	if meta.ProvidersQueried != 1 || meta.ProvidersFailed != 0 {
+		t.Errorf("skipped provider should not count as queried or failed: %+v", meta)
+	}
+
+	// After the cooldown a successful trial closes the breaker again
+	time.Sleep(60 * time.Millisecond)
+	flaky.err = nil
+	meta = search("4")
+	if len(meta.ProvidersSkipped) != 0 || meta.ProvidersSucceeded != 2 {
+		t.Errorf("expected both providers queried after cooldown, got %+v", meta)
+	}
+	if state() != BreakerClosed {
+		t.Errorf("expected breaker closed after successful trial, got %s", state())
+	}
+}
+
+func TestCircuitBreaker_HalfOpenFailureReopens(t *testing.T) {
+	cb := newCircuitBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: 10 * time.Millisecond, HalfOpenSuccesses: 1})
+	cb.record(errors.New("boom"))
+	if cb.allow() {
+		t.Fatal("open breaker should reject requests")
+	}
+	time.Sleep(15 * time.Millisecond)
+	if !cb.allow() {
+		t.Fatal("breaker should allow a trial after the cooldown")
+	}
+	if cb.allow() {
+		t.Fatal("only one trial may run while half-open")
+	}
+	cb.record(errors.New("still down"))
+	if h := cb.health("x"); h.State != BreakerOpen || h.RetryAt == nil {
+		t.Errorf("failed trial should reopen the breaker, got %+v", h)
+	}
+}
+
+func TestAggregatorService_Search_ProviderStatuses(t *testing.T) {
+	dep := time.Date(2025, 12, 24, 8, 0, 0, 0, wib)
+	provs := []providers.Provider{
+		&stubProvider{name: "Up", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}},
+		&stubProvider{name: "Down", err: errors.New("AirAsia API Service Unavailable (503)")},
+	}
+	agg := NewAggregatorService(provs, testClock)
+	resp, err := agg.Search(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-24"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	statuses := resp.Metadata.Providers
+	if len(statuses) != 2 {
+		t.Fatalf("expected a status per provider, got %+v", statuses)
+	}
+	up, down := statuses[0], statuses[1]
+	if up.Name != "Up" || up.Status != models.ProviderOK || up.FlightCount != 1 || up.Attempts != 1 || up.ErrorCode != "" {
+		t.Errorf("unexpected status for healthy provider: %+v", up)
+	}
+	if down.Name != "Down" || down.Status != models.ProviderFailed || down.Attempts != 3 ||
+		down.ErrorCode != models.ErrorCodeProviderError || down.Error != "AirAsia API Service Unavailable (503)" {
+		t.Errorf("unexpected status for failing provider: %+v", down)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	var decoded struct{}
+	syntaxErr := json.Unmarshal([]byte("{"), &decoded)
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{context.DeadlineExceeded, models.ErrorCodeTimeout},
+		{fmt.Errorf("fetch: %w", context.Canceled), models.ErrorCodeCanceled},
+		{syntaxErr, models.ErrorCodeMalformedResponse},
+		{errors.New("boom"), models.ErrorCodeProviderError},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("classifyError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestAggregatorService_FetchWithRetry_ErrorKinds(t *testing.T) {
+	flight := testFlight("GA", "GA1", "CGK", "DPS", time.Date(2025, 12, 25, 8, 0, 0, 0, wib), 110, 900000)
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-25"}
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		wantErr  bool
+		minWait  time.Duration
+	}{
+		{"unavailable is retried", []error{providers.Errorf(providers.KindUnavailable, "503")}, 2, false, 0},
+		{"bad request is not retried", []error{providers.Errorf(providers.KindBadRequest, "bad origin")}, 1, true, 0},
+		{"auth is not retried", []error{providers.Errorf(providers.KindAuth, "expired"), nil}, 1, true, 0},
+		{"canceled is not retried", []error{context.Canceled}, 1, true, 0},
+		{"retry-after is honoured", []error{providers.RateLimited(300*time.Millisecond, "429")}, 2, false, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &scriptedProvider{name: "Scripted", flights: []models.Flight{flight}, errs: tt.errs}
+			agg := NewAggregatorService(nil, testClock)
+			start := time.Now()
+			_, attempts, err := agg.fetchWithRetry(context.Background(), prov, req)
+			if attempts != tt.attempts || prov.calls != tt.attempts {
+				t.Errorf("expected %d attempts, got %d (%d calls)", tt.attempts, attempts, prov.calls)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error result: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minWait {
+				t.Errorf("expected to wait at least %v, waited %v", tt.minWait, elapsed)
+			}
+		})
+	}
+}
+
+func TestAggregatorService_Search_NoAvailabilityIsNotAFailure(t *testing.T) {
+	prov := &scriptedProvider{name: "Empty", errs: []error{providers.Errorf(providers.KindNoAvailability, "no flights")}}
+	agg := NewAggregatorService([]providers.Provider{prov}, testClock)
+	resp, err := agg.Search(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-26"})
+	if err != nil {
+		t.Fatalf("expected an empty result, got %v", err)
+	}
+	st := resp.Metadata.Providers[0]
+	if st.Status != models.ProviderOK || st.ErrorCode != models.ErrorCodeNoAvailability || st.Attempts != 1 {
+		t.Errorf("unexpected provider status: %+v", st)
+	}
+	if h := agg.ProviderHealth()[0]; h.ConsecutiveFailures != 0 {
+		t.Errorf("no availability should not count against the breaker: %+v", h)
+	}
+}
+
+// hangingProvider blocks until its context is done on the first call and answers afterwards.
+type hangingProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *hangingProvider) Name() string { return "Hanging" }
+func (p *hangingProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	p.mu.Lock()
+	p.calls++
+	first := p.calls == 1
+	p.mu.Unlock()
+	if first {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return nil, nil
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond, Multiplier: 2}
+	for retry, want := range []time.Duration{100, 200, 300, 300} {
+		if got := p.backoff(retry + 1); got != want*time.Millisecond {
+			t.Errorf("backoff(%d) = %v, want %v", retry+1, got, want*time.Millisecond)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if got := p.backoff(1); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("jittered backoff out of range: %v", got)
+		}
+	}
+}
+
+func TestAggregatorService_FetchWithRetry_Policy(t *testing.T) {
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-27"}
+	down := func() error { return providers.Errorf(providers.KindUnavailable, "503") }
+
+	t.Run("cancellation interrupts the backoff", func(t *testing.T) {
+		prov := &scriptedProvider{name: "Down", errs: []error{down(), down(), down()}}
+		agg := NewAggregatorService(nil, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: 5 * time.Second, Multiplier: 1}))
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(30*time.Millisecond, cancel)
+		start := time.Now()
+		_, attempts, _ := agg.fetchWithRetry(ctx, prov, req)
+		if elapsed := time.Since(start); elapsed > time.Second || attempts != 1 {
+			t.Errorf("expected to stop right after cancel, took %v over %d attempts", elapsed, attempts)
+		}
+	})
+
+	t.Run("backoff past the deadline is skipped", func(t *testing.T) {
+		prov := &scriptedProvider{name: "Down", errs: []error{down(), down(), down()}}
+		agg := NewAggregatorService(nil, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, Multiplier: 1}))
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, attempts, err := agg.fetchWithRetry(ctx, prov, req)
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond || attempts != 1 || err == nil {
+			t.Errorf("expected an immediate failure, took %v over %d attempts (%v)", elapsed, attempts, err)
+		}
+	})
+
+	t.Run("attempt timeout retries a hung call", func(t *testing.T) {
+		prov := &hangingProvider{}
+		agg := NewAggregatorService(nil, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, AttemptTimeout: 50 * time.Millisecond}))
+		_, attempts, err := agg.fetchWithRetry(context.Background(), prov, req)
+		if err != nil || attempts != 2 {
+			t.Errorf("expected success on the second attempt, got %d attempts (%v)", attempts, err)
+		}
+	})
+
+	t.Run("budget bounds all attempts", func(t *testing.T) {
+		errs := make([]error, 20)
+		for i := range errs {
+			errs[i] = down()
+		}
+		prov := &scriptedProvider{name: "Down", errs: errs}
+		agg := NewAggregatorService(nil, WithRetryPolicy(RetryPolicy{MaxAttempts: 20, BaseDelay: 40 * time.Millisecond, Multiplier: 1, Budget: 100 * time.Millisecond}))
+		start := time.Now()
+		_, attempts, _ := agg.fetchWithRetry(context.Background(), prov, req)
+		if elapsed := time.Since(start); elapsed > 200*time.Millisecond || attempts > 3 {
+			t.Errorf("budget exceeded: %v over %d attempts", elapsed, attempts)
+		}
+	})
+
+	t.Run("per provider policy", func(t *testing.T) {
+		prov := &scriptedProvider{name: "Down", errs: []error{down(), down(), down()}}
+		agg := NewAggregatorService(nil, WithProviderRetryPolicy("Down", RetryPolicy{MaxAttempts: 1}))
+		if _, attempts, _ := agg.fetchWithRetry(context.Background(), prov, req); attempts != 1 {
+			t.Errorf("expected the provider's own policy to allow a single attempt, got %d", attempts)
+		}
+	})
+}
+
+func TestAggregatorService_SearchStream(t *testing.T) {
+	dep := time.Date(2025, 12, 28, 8, 0, 0, 0, wib)
+	fast := &stubProvider{name: "Fast", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	slow := &stubProvider{name: "Slow", delay: 50 * time.Millisecond, flights: []models.Flight{testFlight("ID", "ID2", "CGK", "DPS", dep.Add(time.Hour), 110, 700000)}}
+	agg := NewAggregatorService([]providers.Provider{slow, fast}, testClock)
+
+	events, err := agg.SearchStream(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-28"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []models.SearchEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected two provider events and a done event, got %d", len(got))
+	}
+
+	if got[0].Type != models.EventProvider || got[0].Provider.Name != "Fast" || len(got[0].Flights) != 1 {
+		t.Errorf("expected the fast provider first with its flight, got %+v", got[0])
+	}
+	if got[1].Provider.Name != "Slow" || len(got[1].Flights) != 2 || got[1].Flights[0].FlightNumber != "ID2" {
+		t.Errorf("expected the merged, re-ranked list after the slow provider, got %+v", got[1].Flights)
+	}
+	done := got[2]
+	if done.Type != models.EventDone || done.Err != nil || done.Metadata == nil || done.Metadata.ProvidersSucceeded != 2 || len(done.Flights) != 2 {
+		t.Errorf("unexpected done event: %+v", done)
+	}
+}
+
+func TestAggregatorService_SearchStream_Timeout(t *testing.T) {
+	dep := time.Date(2025, 12, 29, 8, 0, 0, 0, wib)
+	fast := &stubProvider{name: "Fast", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	stuck := &stubProvider{name: "Stuck", delay: time.Second}
+	agg := NewAggregatorService([]providers.Provider{fast, stuck}, testClock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	events, err := agg.SearchStream(ctx, models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-29"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var done models.SearchEvent
+	for ev := range events {
+		done = ev
+	}
+	if !errors.Is(done.Err, context.DeadlineExceeded) || len(done.Flights) != 1 {
+		t.Fatalf("expected a timeout with the fast provider's flight, got %v with %d flights", done.Err, len(done.Flights))
+	}
+	if st := done.Metadata.Providers[1]; st.Name != "Stuck" || st.ErrorCode != models.ErrorCodeTimeout {
+		t.Errorf("expected the stuck provider marked as timed out, got %+v", st)
+	}
+}
+
+func TestAggregatorService_Search_SoftDeadline(t *testing.T) {
+	dep := time.Date(2025, 12, 30, 8, 0, 0, 0, wib)
+	fast := &stubProvider{name: "Fast", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	slow := &stubProvider{name: "Slow", delay: 150 * time.Millisecond, flights: []models.Flight{testFlight("ID", "ID2", "CGK", "DPS", dep.Add(time.Hour), 110, 700000)}}
+	agg := NewAggregatorService([]providers.Provider{fast, slow}, testClock,
+		WithSoftDeadline(SoftDeadline{Budget: 40 * time.Millisecond, WarmCache: true}))
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-30"}
+
+	start := time.Now()
+	resp, err := agg.Search(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected partial results, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 120*time.Millisecond {
+		t.Errorf("expected to return around the soft deadline, took %v", elapsed)
+	}
+	if !resp.Metadata.Partial || len(resp.Flights) != 1 || resp.Metadata.ProvidersFailed != 1 {
+		t.Fatalf("expected the fast provider's flight only, got %+v", resp.Metadata)
+	}
+	if st := resp.Metadata.Providers[1]; st.Name != "Slow" || st.Status != models.ProviderFailed || st.ErrorCode != models.ErrorCodeTimeout {
+		t.Errorf("expected the straggler marked as timed out, got %+v", st)
+	}
+
+	// The straggler finishes in the background and warms the cache
+	time.Sleep(200 * time.Millisecond)
+	resp, err = agg.Search(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Metadata.CacheHit || resp.Metadata.Partial || len(resp.Flights) != 2 {
+		t.Errorf("expected the complete result from the warmed cache, got %+v", resp.Metadata)
+	}
+}
+
+func TestAggregatorService_Search_SoftDeadlineWithoutAnswers(t *testing.T) {
+	slow := &stubProvider{name: "Slow", delay: time.Second}
+	agg := NewAggregatorService([]providers.Provider{slow}, testClock, WithSoftDeadline(SoftDeadline{Budget: 20 * time.Millisecond}))
+	_, err := agg.Search(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-31"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error when nobody answered, got %v", err)
+	}
+}
+
+func TestAggregatorService_Search_SoftDeadlineOnHardTimeout(t *testing.T) {
+	dep := time.Date(2026, 1, 2, 8, 0, 0, 0, wib)
+	fast := &stubProvider{name: "Fast", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	slow := &stubProvider{name: "Slow", delay: time.Second}
+	agg := NewAggregatorService([]providers.Provider{fast, slow}, testClock, WithSoftDeadline(SoftDeadline{Budget: time.Minute}))
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Millisecond)
+	defer cancel()
+	resp, err := agg.Search(ctx, models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-02"})
+	if err != nil || !resp.Metadata.Partial || len(resp.Flights) != 1 {
+		t.Errorf("expected best available results when the context expires, got %v (%+v)", err, resp.Metadata)
+	}
+}
+
+// panickingProvider simulates a buggy provider implementation.
+type panickingProvider struct{}
+
+func (p *panickingProvider) Name() string { return "Panicky" }
+func (p *panickingProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	var flights map[string]models.Flight
+	flights["boom"] = models.Flight{} // assignment to nil map
+	return nil, nil
+}
+
+func TestAggregatorService_Search_ProviderPanic(t *testing.T) {
+	dep := time.Date(2026, 1, 3, 8, 0, 0, 0, wib)
+	healthy := &stubProvider{name: "Healthy", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	agg := NewAggregatorService([]providers.Provider{&panickingProvider{}, healthy}, testClock)
+
+	resp, err := agg.Search(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-03"})
+	if err != nil {
+		t.Fatalf("a panicking provider should not fail the search: %v", err)
+	}
+	if len(resp.Flights) != 1 || resp.Metadata.ProvidersFailed != 1 {
+		t.Errorf("expected the healthy provider's flight, got %+v", resp.Metadata)
+	}
+	if st := resp.Metadata.Providers[0]; st.Status != models.ProviderFailed || !strings.HasPrefix(st.Error, "panic:") {
+		t.Errorf("expected the panic reported as a failure, got %+v", st)
+	}
+	if h := agg.ProviderHealth()[1]; h.Name != "Panicky" || h.ConsecutiveFailures != 1 {
+		t.Errorf("expected the panic to count against the breaker, got %+v", h)
+	}
+}
+
+func TestAggregatorService_ConcurrentSearches(t *testing.T) {
+	dep := time.Date(2026, 1, 4, 8, 0, 0, 0, wib)
+	var provs []providers.Provider
+	for i := 0; i < 6; i++ {
+		provs = append(provs, &stubProvider{
+			name:    fmt.Sprintf("P%d", i),
+			delay:   time.Duration(i) * time.Millisecond,
+			flights: []models.Flight{testFlight("GA", fmt.Sprintf("GA%d", i), "CGK", "DPS", dep.Add(time.Duration(i)*time.Hour), 110, 900000+i)},
+		})
+	}
+	provs = append(provs, &stubProvider{name: "Down", err: providers.Errorf(providers.KindAuth, "bad key")})
+	agg := NewAggregatorService(provs, testClock, WithMaxParallelFetches(2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := agg.Search(context.Background(), models.SearchRequest{
+				Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-04", Passengers: strconv.Itoa(i%9 + 1),
+			})
+			if err != nil {
+				t.Errorf("search %d: %v", i, err)
+				return
+			}
+			if !resp.Metadata.CacheHit && (resp.Metadata.ProvidersSucceeded != 6 || resp.Metadata.ProvidersFailed != 1 || len(resp.Flights) != 6) {
+				t.Errorf("search %d: unexpected metadata %+v", i, resp.Metadata)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestAggregatorService_SetProviderEnabled(t *testing.T) {
+	dep := time.Date(2026, 1, 5, 8, 0, 0, 0, wib)
+	a := &stubProvider{name: "A", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	b := &stubProvider{name: "B", flights: []models.Flight{testFlight("JT", "JT2", "CGK", "DPS", dep.Add(time.Hour), 110, 800000)}}
+	agg := NewAggregatorService([]providers.Provider{a, b}, testClock, WithDisabledProviders("B"))
+	search := func(passengers string) models.SearchResponse {
+		t.Helper()
+		resp, err := agg.Search(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-05", Passengers: passengers})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	if resp := search("1"); len(resp.Flights) != 1 || resp.Metadata.ProvidersQueried != 1 {
+		t.Errorf("expected only A to be queried, got %+v", resp.Metadata)
+	}
+	if err := agg.SetProviderEnabled("B", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := agg.SetProviderEnabled("A", false); err != nil {
+		t.Fatal(err)
+	}
+	// The same search again must not be answered with A's cached flights
+	if resp := search("1"); len(resp.Flights) != 1 || resp.Flights[0].FlightNumber != "JT2" || resp.Metadata.CacheHit {
+		t.Errorf("expected only B's flight after toggling, got %+v", resp.Flights)
+	}
+	if err := agg.SetProviderEnabled("A", true); err != nil {
+		t.Fatal(err)
+	}
+	if resp := search("1"); len(resp.Flights) != 2 || resp.Metadata.ProvidersQueried != 2 {
+		t.Errorf("expected both providers once A is back, got %+v", resp.Metadata)
+	}
+	if err := agg.SetProviderEnabled("A", false); err != nil {
+		t.Fatal(err)
+	}
+	if resp := search("1"); len(resp.Flights) != 1 || resp.Flights[0].FlightNumber != "JT2" || resp.Metadata.ProvidersQueried != 1 {
+		t.Errorf("expected the disabled provider's flight gone from the next search, got %+v %+v", resp.Flights, resp.Metadata)
+	}
+	if err := agg.SetProviderEnabled("C", true); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("expected ErrUnknownProvider, got %v", err)
+	}
+	if h := agg.ProviderHealth(); h[0].Enabled || !h[1].Enabled {
+		t.Errorf("health should report the enabled flags: %+v", h)
+	}
+}
+
+func TestMemoryCache_Eviction(t *testing.T) {
+	resp := func(n int) models.SearchResponse {
+		return models.SearchResponse{Metadata: models.Metadata{TotalResults: n}}
+	}
+
+	for _, tt := range []struct {
+		policy  EvictionPolicy
+		evicted string
+	}{
+		{EvictFIFO, "a"},
+		{EvictLRU, "b"},
+	} {
+		c := NewMemoryCache(CacheOptions{MaxSize: 2, Eviction: tt.policy})
+		c.Set("a", resp(1))
+		c.Set("b", resp(2))
+		c.Get("a")
+		c.Set("c", resp(3))
+		if _, ok := c.Get(tt.evicted); ok {
+			t.Errorf("%s: expected %q to be evicted", tt.policy, tt.evicted)
+		}
+		if got, ok := c.Get("c"); !ok || got.Metadata.TotalResults != 3 {
+			t.Errorf("%s: expected the new entry, got %v %v", tt.policy, got, ok)
+		}
+	}
+
+	c := NewMemoryCache(CacheOptions{TTL: 10 * time.Millisecond})
+	c.Set("a", resp(1))
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected the entry to expire")
+	}
+}
+
+// recordingCache is a Cache backed by a plain map that counts its calls.
+type recordingCache struct {
+	mu         sync.Mutex
+	store      map[string]models.SearchResponse
+	gets, sets int
+}
+
+func (c *recordingCache) Get(key string) (models.SearchResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gets++
+	resp, ok := c.store[key]
+	return resp, ok
+}
+
+func (c *recordingCache) Set(key string, value models.SearchResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sets++
+	c.store[key] = value
+}
+
+func TestAggregatorService_CacheIsScoped(t *testing.T) {
+	dep := time.Date(2026, 1, 6, 8, 0, 0, 0, wib)
+	prov := &stubProvider{name: "A", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-06"}
+	search := func(agg *AggregatorService) models.SearchResponse {
+		t.Helper()
+		resp, err := agg.Search(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	first := NewAggregatorService([]providers.Provider{prov}, testClock)
+	search(first)
+	if !search(first).Metadata.CacheHit {
+		t.Error("expected the second search to hit the service's cache")
+	}
+	if search(NewAggregatorService([]providers.Provider{prov}, testClock)).Metadata.CacheHit {
+		t.Error("expected a new service to start with an empty cache")
+	}
+
+	shared := &recordingCache{store: make(map[string]models.SearchResponse)}
+	search(NewAggregatorService([]providers.Provider{prov}, testClock, WithCache(shared)))
+	if !search(NewAggregatorService([]providers.Provider{prov}, testClock, WithCache(shared))).Metadata.CacheHit || shared.sets != 1 {
+		t.Errorf("expected services to share an injected cache, %d sets", shared.sets)
+	}
+
+	uncached := NewAggregatorService([]providers.Provider{prov}, testClock, WithCache(nil))
+	search(uncached)
+	if search(uncached).Metadata.CacheHit {
+		t.Error("expected WithCache(nil) to turn caching off")
+	}
+}
+
+func TestMemoryCache_ResetAndStats(t *testing.T) {
+	resp := func(n int) models.SearchResponse {
+		return models.SearchResponse{Metadata: models.Metadata{TotalResults: n}}
+	}
+
+	// Storing a key again refreshes it instead of queueing a duplicate for eviction
+	c := NewMemoryCache(CacheOptions{MaxSize: 2, Eviction: EvictFIFO})
+	c.Set("a", resp(1))
+	c.Set("b", resp(2))
+	c.Set("a", resp(3))
+	c.Set("c", resp(4))
+	if got, ok := c.Get("a"); !ok || got.Metadata.TotalResults != 3 {
+		t.Errorf("expected the refreshed entry to survive, got %v %v", got, ok)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected the oldest entry to be evicted")
+	}
+	if s := c.Stats(); s.Hits != 1 || s.Misses != 1 || s.Evictions != 1 || s.Entries != 2 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestMemoryCache_MaxBytes(t *testing.T) {
+	small := models.SearchResponse{Flights: []models.Flight{{ID: "a"}}}
+	size := encodedSize(small)
+	c := NewMemoryCache(CacheOptions{MaxBytes: 2*size + size/2})
+
+	c.Set("a", small)
+	c.Set("b", small)
+	c.Set("c", small)
+	if s := c.Stats(); s.Entries != 2 || s.Bytes != 2*size || s.Evictions != 1 {
+		t.Errorf("expected the byte limit to hold two responses, got %+v", s)
+	}
+
+	big := models.SearchResponse{Flights: make([]models.Flight, 10)}
+	c.Set("big", big)
+	if _, ok := c.Get("big"); ok {
+		t.Error("expected a response over the byte limit not to be cached")
+	}
+	if s := c.Stats(); s.Entries != 2 {
+		t.Errorf("an oversized response should not evict others, got %+v", s)
+	}
+}
+
+func TestMemoryCache_Sweeper(t *testing.T) {
+	c := NewMemoryCache(CacheOptions{TTL: 5 * time.Millisecond, SweepInterval: 5 * time.Millisecond})
+	defer c.Close()
+	c.Set("a", models.SearchResponse{})
+
+	deadline := time.Now().Add(time.Second)
+	for c.Stats().Entries > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if s := c.Stats(); s.Entries != 0 || s.Expirations != 1 || s.Bytes != 0 {
+		t.Errorf("expected the sweeper to drop the expired entry, got %+v", s)
+	}
+}
+
+func TestCacheKey_Canonical(t *testing.T) {
+	intp := func(n int) *int { return &n }
+	strp := func(s string) *string { return &s }
+	base := func() models.SearchRequest {
+		return models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-07", Passengers: "1", CabinClass: "economy"}
+	}
+
+	a, b := base(), base()
+	a.MaxPrice, b.MaxPrice = intp(1000000), intp(1000000)
+	a.SortBy, b.SortBy = strp("price_asc"), strp("price_asc")
+	a.Airlines, b.Airlines = []string{"JT", "GA"}, []string{"GA", "JT", "GA"}
+	if cacheKey(a, nil) != cacheKey(b, nil) {
+		t.Error("expected equal filter values behind different pointers to share a key")
+	}
+
+	same := []func(*models.SearchRequest){
+		func(r *models.SearchRequest) { r.Origin = "cgk" },
+		func(r *models.SearchRequest) { r.Passengers = "" },
+		func(r *models.SearchRequest) { r.CabinClass = "" },
+		func(r *models.SearchRequest) { r.MinPrice = intp(0) },
+		func(r *models.SearchRequest) { r.SortBy = strp("") },
+		func(r *models.SearchRequest) { r.Airlines = []string{} },
+		func(r *models.SearchRequest) { r.DepartureTimeStart = strp("06:00") },
+	}
+	for i, mutate := range same {
+		r := base()
+		mutate(&r)
+		if cacheKey(r, nil) != cacheKey(base(), nil) {
+			t.Errorf("case %d: expected %+v to share the default request's key", i, r)
+		}
+	}
+
+	different := []func(*models.SearchRequest){
+		func(r *models.SearchRequest) { r.DepartureDate = "2026-01-08" },
+		func(r *models.SearchRequest) { r.Passengers = "2" },
+		func(r *models.SearchRequest) { r.MaxPrice = intp(0) },
+		func(r *models.SearchRequest) { r.SortBy = strp("price_desc") },
+		func(r *models.SearchRequest) { r.DepartureTimeStart, r.DepartureTimeEnd = strp("06:00"), strp("12:00") },
+	}
+	for i, mutate := range different {
+		r := base()
+		mutate(&r)
+		if cacheKey(r, nil) == cacheKey(base(), nil) {
+			t.Errorf("case %d: expected %+v to get its own key", i, r)
+		}
+	}
+
+	if cacheKey(base(), []string{"A", "B"}) != cacheKey(base(), []string{"B", "A"}) {
+		t.Error("expected the provider order to leave the key alone")
+	}
+	if cacheKey(base(), []string{"A", "B"}) == cacheKey(base(), []string{"A"}) {
+		t.Error("expected a different set of providers to get its own key")
+	}
+
+	filtered := base()
+	filtered.MaxPrice = intp(500000)
+	if routeKey(filtered) != routeKey(base()) {
+		t.Error("expected filters to leave the route key alone")
+	}
+}
+
+func TestAggregatorService_Search_EquivalentRequestsHitCache(t *testing.T) {
+	dep := time.Date(2026, 1, 7, 8, 0, 0, 0, wib)
+	prov := &stubProvider{name: "A", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	agg := NewAggregatorService([]providers.Provider{prov}, testClock)
+	maxPrice, again := 1000000, 1000000
+
+	first := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-07", MaxPrice: &maxPrice, Airlines: []string{"GA", "JT"}}
+	if _, err := agg.Search(context.Background(), first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second := first
+	second.MaxPrice, second.Airlines = &again, []string{"JT", "GA"}
+	resp, err := agg.Search(context.Background(), second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Metadata.CacheHit || len(resp.Flights) != 1 {
+		t.Errorf("expected the equivalent request to hit the cache, got %+v", resp.Metadata)
+	}
+	if resp.SearchCriteria.Airlines[0] != "JT" {
+		t.Errorf("expected the response to echo the request it answers, got %+v", resp.SearchCriteria)
+	}
+}
+
+func TestAggregatorService_ProviderCache(t *testing.T) {
+	dep := time.Date(2026, 1, 8, 8, 0, 0, 0, wib)
+	a := &scriptedProvider{name: "A", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	b := &scriptedProvider{name: "B", flights: []models.Flight{testFlight("JT", "JT2", "CGK", "DPS", dep.Add(time.Hour), 110, 800000)},
+		errs: []error{providers.Errorf(providers.KindUnavailable, "down")}}
+	agg := NewAggregatorService([]providers.Provider{a, b}, testClock, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-08"}
+	search := func(req models.SearchRequest) models.SearchResponse {
+		t.Helper()
+		resp, err := agg.Search(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	if resp := search(req); len(resp.Flights) != 1 {
+		t.Fatalf("expected only A's flight while B is down, got %+v", resp.Flights)
+	}
+	// The incomplete response isn't cached; only the failed provider is called again
+	resp := search(req)
+	if resp.Metadata.CacheHit || len(resp.Flights) != 2 || a.calls != 1 || b.calls != 2 {
+		t.Errorf("expected B alone to be refetched, got %d flights, calls A=%d B=%d", len(resp.Flights), a.calls, b.calls)
+	}
+	if st := resp.Metadata.Providers; !st[0].Cached || st[1].Cached || st[0].FlightCount != 1 {
+		t.Errorf("expected A to be reported as cached, got %+v", st)
+	}
+
+	// A new sort order misses the response cache but reuses every provider's flights
+	sortBy := "price_asc"
+	sorted := req
+	sorted.SortBy = &sortBy
+	resp = search(sorted)
+	if resp.Metadata.CacheHit || a.calls != 1 || b.calls != 2 {
+		t.Errorf("expected the pipeline to rerun on cached flights, calls A=%d B=%d", a.calls, b.calls)
+	}
+	if len(resp.Flights) != 2 || resp.Flights[0].FlightNumber != "JT2" {
+		t.Errorf("expected the cached flights sorted by price, got %+v", resp.Flights)
+	}
+}
+
+func TestAggregatorService_ProviderCacheTTL(t *testing.T) {
+	dep := time.Date(2026, 1, 9, 8, 0, 0, 0, wib)
+	a := &scriptedProvider{name: "A", flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)}}
+	b := &scriptedProvider{name: "B", flights: []models.Flight{testFlight("JT", "JT2", "CGK", "DPS", dep.Add(time.Hour), 110, 800000)}}
+	agg := NewAggregatorService([]providers.Provider{a, b}, testClock, WithCache(nil),
+		WithProviderCache(ProviderCacheOptions{TTL: time.Minute, ProviderTTL: map[string]time.Duration{"B": 0}}))
+
+	for i := 0; i < 3; i++ {
+		if _, err := agg.Search(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-09"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if a.calls != 1 || b.calls != 3 {
+		t.Errorf("expected only A to be cached, calls A=%d B=%d", a.calls, b.calls)
+	}
+	if s := agg.ProviderCacheStats(); s.Entries != 1 || s.Hits != 2 {
+		t.Errorf("unexpected provider cache stats %+v", s)
+	}
+}
+
+// gatedProvider holds every call until released or its context is done.
+type gatedProvider struct {
+	flights  []models.Flight
+	release  chan struct{}
+	mu       sync.Mutex
+	calls    int
+	canceled int
+}
+
+func (p *gatedProvider) Name() string { return "Gated" }
+func (p *gatedProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+	select {
+	case <-p.release:
+		return p.flights, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.canceled++
+		p.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (p *gatedProvider) counts() (calls, canceled int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls, p.canceled
+}
+
+// waitForWaiters blocks until n callers share the search in flight under the request's key.
+func waitForWaiters(t *testing.T, agg *AggregatorService, req models.SearchRequest, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		agg.inflight.mu.Lock()
+		c := agg.inflight.calls[cacheKey(req, providerNames(agg.activeProviders()))]
+		joined := c != nil && len(c.waiters) == n
+		agg.inflight.mu.Unlock()
+		if joined {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d callers to share the search", n)
+}
+
+func newCoalescingTestService() (*AggregatorService, *gatedProvider) {
+	dep := time.Date(2026, 1, 10, 8, 0, 0, 0, wib)
+	p := &gatedProvider{
+		flights: []models.Flight{testFlight("GA", "GA1", "CGK", "DPS", dep, 110, 900000)},
+		release: make(chan struct{}),
+	}
+	agg := NewAggregatorService([]providers.Provider{p}, testClock, WithCache(nil),
+		WithProviderCache(ProviderCacheOptions{}), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	return agg, p
+}
+
+func TestAggregatorService_Search_CoalescesIdenticalSearches(t *testing.T) {
+	agg, p := newCoalescingTestService()
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-10"}
+
+	var wg sync.WaitGroup
+	resps := make([]models.SearchResponse, 5)
+	for i := range resps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Equivalent spellings share the fan-out but each gets its own criteria back
+			r := req
+			if i%2 == 1 {
+				r.Passengers = "1"
+			}
+			resp, err := agg.Search(context.Background(), r)
+			if err != nil {
+				t.Errorf("search %d: %v", i, err)
+			}
+			resps[i] = resp
+		}(i)
+	}
+	waitForWaiters(t, agg, req, len(resps))
+	close(p.release)
+	wg.Wait()
+
+	if calls, _ := p.counts(); calls != 1 {
+		t.Errorf("expected one provider call for identical searches, got %d", calls)
+	}
+	for i, resp := range resps {
+		if len(resp.Flights) != 1 || resp.Metadata.ProvidersSucceeded != 1 {
+			t.Errorf("search %d: unexpected response %+v", i, resp.Metadata)
+		}
+		if want := map[bool]string{false: "", true: "1"}[i%2 == 1]; resp.SearchCriteria.Passengers != want {
+			t.Errorf("search %d: expected its own criteria echoed, got %q", i, resp.SearchCriteria.Passengers)
+		}
+	}
+	if len(agg.inflight.calls) != 0 {
+		t.Errorf("expected the finished search to be forgotten, got %d in flight", len(agg.inflight.calls))
+	}
+}
+
+func TestAggregatorService_Search_CoalescedCallerCancels(t *testing.T) {
+	agg, p := newCoalescingTestService()
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-10"}
+
+	// The caller that started the fan-out goes away; the one that joined still gets answers
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := agg.Search(ctx, req)
+		leaderErr <- err
+	}()
+	waitForWaiters(t, agg, req, 1)
+
+	type result struct {
+		resp models.SearchResponse
+		err  error
+	}
+	joined := make(chan result, 1)
+	go func() {
+		resp, err := agg.Search(context.Background(), req)
+		joined <- result{resp, err}
+	}()
+	waitForWaiters(t, agg, req, 2)
+
+	cancel()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled caller to get its context error, got %v", err)
+	}
+	close(p.release)
+	r := <-joined
+	if r.err != nil || len(r.resp.Flights) != 1 {
+		t.Errorf("expected the remaining caller to get the flights, got %d, %v", len(r.resp.Flights), r.err)
+	}
+	if calls, canceled := p.counts(); calls != 1 || canceled != 0 {
+		t.Errorf("expected one uninterrupted provider call, got %d calls, %d canceled", calls, canceled)
+	}
+}
+
+func TestAggregatorService_Search_CoalescedLeaderTimesOut(t *testing.T) {
+	agg, p := newCoalescingTestService()
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-10"}
+
+	// The caller that started the fan-out has a shorter deadline than the one that joined
+	leaderCtx, cancelLeader := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelLeader()
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := agg.Search(leaderCtx, req)
+		leaderErr <- err
+	}()
+	waitForWaiters(t, agg, req, 1)
+
+	followerCtx, cancelFollower := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelFollower()
+	type result struct {
+		resp models.SearchResponse
+		err  error
+	}
+	joined := make(chan result, 1)
+	go func() {
+		resp, err := agg.Search(followerCtx, req)
+		joined <- result{resp, err}
+	}()
+	waitForWaiters(t, agg, req, 2)
+
+	if err := <-leaderErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the leader to time out, got %v", err)
+	}
+	select {
+	case r := <-joined:
+		t.Fatalf("expected the follower to keep waiting past the leader's deadline, got %v", r.err)
+	default:
+	}
+	close(p.release)
+	r := <-joined
+	if r.err != nil || len(r.resp.Flights) != 1 {
+		t.Errorf("expected the follower to get the flights, got %d, %v", len(r.resp.Flights), r.err)
+	}
+	if followerCtx.Err() != nil {
+		t.Errorf("expected the follower's own context to still be live")
+	}
+	if calls, canceled := p.counts(); calls != 1 || canceled != 0 {
+		t.Errorf("expected one uninterrupted provider call, got %d calls, %d canceled", calls, canceled)
+	}
+}
+
+func TestSearchGroup_SharedDeadline(t *testing.T) {
+	var g searchGroup
+	started := make(chan struct{})
+	deadlines := make(chan time.Time, 1)
+	release := make(chan struct{})
+	short, cancelShort := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelShort()
+	long, cancelLong := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancelLong()
+
+	go g.do(short, "k", func(ctx context.Context) (models.SearchResponse, error) {
+		close(started)
+		<-release
+		d, _ := ctx.Deadline()
+		deadlines <- d
+		return models.SearchResponse{}, nil
+	})
+	<-started
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.do(long, "k", nil)
+	}()
+	for {
+		g.mu.Lock()
+		n := len(g.calls["k"].waiters)
+		g.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-done
+	if want, _ := long.Deadline(); !(<-deadlines).Equal(want) {
+		t.Error("expected the shared search to run until the latest caller's deadline")
+	}
+}
+
+func TestAggregatorService_Search_CoalescedSearchCanceledWhenAllLeave(t *testing.T) {
+	agg, p := newCoalescingTestService()
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-10"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := agg.Search(ctx, req); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context.Canceled, got %v", err)
+			}
+		}()
+	}
+	waitForWaiters(t, agg, req, 3)
+	cancel()
+	wg.Wait()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for _, canceled := p.counts(); canceled != 1; _, canceled = p.counts() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the shared fetch to be canceled once every caller left")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A later search starts afresh rather than joining the abandoned one
+	close(p.release)
+	resp, err := agg.Search(context.Background(), req)
+	if err != nil || len(resp.Flights) != 1 {
+		t.Errorf("expected a fresh search to succeed, got %d flights, %v", len(resp.Flights), err)
+	}
+	if calls, _ := p.counts(); calls != 2 {
+		t.Errorf("expected a second provider call, got %d", calls)
+	}
+}
+
+func TestSearchGroup_Panic(t *testing.T) {
+	var g searchGroup
+	_, err := g.do(context.Background(), "k", func(context.Context) (models.SearchResponse, error) {
+		panic("boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected the panic as an error, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package aggregator
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"flight-aggregator/models"
+)
+
+// Circuit breaker states as reported in provider health.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerConfig tunes the per-provider circuit breakers.
+type BreakerConfig struct {
+	FailureThreshold  int           // consecutive failed searches that open the breaker
+	Cooldown          time.Duration // time spent open before a trial request is let through
+	HalfOpenSuccesses int           // successful trials needed to close the breaker again
+}
+
+// DefaultBreakerConfig opens after 5 consecutive failures and retries after 30 seconds.
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{FailureThreshold: 5, Cooldown: 30 * time.Second, HalfOpenSuccesses: 1}
+}
+
+// WithCircuitBreaker replaces the circuit breaker configuration used for every provider.
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(s *AggregatorService) {
+		s.breakerConfig = cfg
+	}
+}
+
+// circuitBreaker tracks the health of a single provider. While open, the provider is
+// skipped entirely; after the cooldown one trial request at a time is allowed through.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	cfg       BreakerConfig
+	state     string
+	failures  int // consecutive failures
+	successes int // successful trials while half-open
+	probing   bool
+	openedAt  time.Time
+	lastErr   string
+	lastFail  time.Time
+	lastOK    time.Time
+}
+
+func newCircuitBreaker(cfg BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{cfg: cfg, state: BreakerClosed}
+}
+
+// allow reports whether a request may be sent, moving an open breaker to half-open
+// once the cooldown has passed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.successes = 0
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record feeds the outcome of an allowed request back into the breaker.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+
+	if err == nil {
+		b.lastOK = time.Now()
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.successes++
+			if b.successes >= b.cfg.HalfOpenSuccesses {
+				b.state = BreakerClosed
+			}
+		}
+		return
+	}
+
+	b.lastFail = time.Now()
+	b.lastErr = err.Error()
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = b.lastFail
+	}
+}
+
+// release gives back a trial slot without recording an outcome, e.g. when the search
+// itself was cancelled and says nothing about the provider.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) health(name string) models.ProviderHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := models.ProviderHealth{
+		Name:                name,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastErr,
+	}
+	if !b.lastFail.IsZero() {
+		t := b.lastFail
+		h.LastFailureAt = &t
+	}
+	if !b.lastOK.IsZero() {
+		t := b.lastOK
+		h.LastSuccessAt = &t
+	}
+	if b.state != BreakerClosed {
+		t := b.openedAt
+		h.OpenedAt = &t
+		if retry := b.openedAt.Add(b.cfg.Cooldown); b.state == BreakerOpen {
+			h.RetryAt = &retry
+		}
+	}
+	return h
+}
+
+// breaker returns the circuit breaker for a provider, creating it on first use.
+func (s *AggregatorService) breaker(name string) *circuitBreaker {
+	s.breakersMu.Lock()
+	defer s.breakersMu.Unlock()
+	b, ok := s.breakers[name]
+	if !ok {
+		b = newCircuitBreaker(s.breakerConfig)
+		s.breakers[name] = b
+	}
+	return b
+}
+
+// ProviderHealth reports the circuit breaker state of every configured provider, enabled or not.
+func (s *AggregatorService) ProviderHealth() []models.ProviderHealth {
+	health := make([]models.ProviderHealth, 0, len(s.providers))
+	for _, p := range s.providers {
+		h := s.breaker(p.Name()).health(p.Name())
+		h.Enabled = s.providerEnabled(p.Name())
+		health = append(health, h)
+	}
+	sort.Slice(health, func(i, j int) bool { return health[i].Name < health[j].Name })
+	return health
+}
@@ -1,82 +1,350 @@
 package aggregator
 
 import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"flight-aggregator/models"
 )
 
-// Production-ready in-memory cache with expiration and size limit
+// Cache stores search responses by key. Implementations must be safe for concurrent use;
+// expiry is up to the backend.
+type Cache interface {
+	Get(key string) (models.SearchResponse, bool)
+	Set(key string, value models.SearchResponse)
+}
+
+// EvictionPolicy picks the entry a full cache drops to make room.
+type EvictionPolicy string
+
+const (
+	// EvictFIFO drops the entry stored longest ago.
+	EvictFIFO EvictionPolicy = "fifo"
+	// EvictLRU drops the entry read or stored longest ago.
+	EvictLRU EvictionPolicy = "lru"
+)
+
+// CacheOptions tunes the in-memory cache.
+type CacheOptions struct {
+	TTL           time.Duration // how long a response is served, defaults to 5 minutes
+	MaxSize       int           // entries kept, defaults to 1000
+	MaxBytes      int64         // total encoded size of the responses kept, 0 for no limit
+	Eviction      EvictionPolicy
+	SweepInterval time.Duration // how often expired entries are purged in the background, 0 to only drop them when read or evicted
+}
 
-type cacheEntry struct {
-	value     models.SearchResponse
+// DefaultCacheOptions keeps 1000 responses for 5 minutes, evicting the least recently
+// used first and sweeping expired entries every minute.
+func DefaultCacheOptions() CacheOptions {
+	return CacheOptions{TTL: 5 * time.Minute, MaxSize: 1000, Eviction: EvictLRU, SweepInterval: time.Minute}
+}
+
+// WithCache replaces the in-memory cache created for the service, e.g. with a shared or
+// differently tuned backend. A nil cache turns caching off.
+func WithCache(c Cache) Option {
+	return func(s *AggregatorService) {
+		if c == nil {
+			c = noCache{}
+		}
+		s.cache = c
+	}
+}
+
+// newServiceCache is the cache a service gets without WithCache. It has no sweeper,
+// which would outlive the service, so expired entries go when read or evicted.
+func newServiceCache() *MemoryCache {
+	opts := DefaultCacheOptions()
+	opts.SweepInterval = 0
+	return NewMemoryCache(opts)
+}
+
+type noCache struct{}
+
+func (noCache) Get(string) (models.SearchResponse, bool) { return models.SearchResponse{}, false }
+func (noCache) Set(string, models.SearchResponse)        {}
+
+// CacheStats counts what a MemoryCache has done since it was created.
+type CacheStats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`   // entries dropped to make room
+	Expirations uint64 `json:"expirations"` // entries dropped after their TTL
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// MemoryCache is an in-process Cache with expiration and entry and byte limits. Reads,
+// writes and evictions are O(1).
+type MemoryCache struct {
+	store *lru[models.SearchResponse]
+	ttl   time.Duration
+}
+
+// NewMemoryCache creates an in-memory cache; zero options take their defaults, except
+// for MaxBytes and SweepInterval. With a sweep interval, Close stops the sweeper.
+func NewMemoryCache(opts CacheOptions) *MemoryCache {
+	def := DefaultCacheOptions()
+	if opts.TTL <= 0 {
+		opts.TTL = def.TTL
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = def.MaxSize
+	}
+	if opts.Eviction == "" {
+		opts.Eviction = def.Eviction
+	}
+	return &MemoryCache{
+		store: newLRU[models.SearchResponse](opts.MaxSize, opts.MaxBytes, opts.Eviction, opts.SweepInterval),
+		ttl:   opts.TTL,
+	}
+}
+
+func (c *MemoryCache) Get(key string) (models.SearchResponse, bool) {
+	return c.store.get(key)
+}
+
+// Set stores a response, replacing any previous one under the key. A response larger
+// than MaxBytes on its own is not cached.
+func (c *MemoryCache) Set(key string, value models.SearchResponse) {
+	c.store.set(key, value, encodedSize(value), c.ttl)
+}
+
+// Stats returns the counters and current size of the cache.
+func (c *MemoryCache) Stats() CacheStats {
+	return c.store.stats()
+}
+
+// Close stops the background sweeper. The cache remains usable.
+func (c *MemoryCache) Close() {
+	c.store.close()
+}
+
+type lruEntry[V any] struct {
+	key       string
+	value     V
+	size      int64
 	expiresAt time.Time
 }
 
-type aggregatorCache struct {
-	mu      sync.RWMutex
-	store   map[string]cacheEntry
-	maxSize int
-	ttl     time.Duration
-	order   []string // FIFO order for eviction
+// lru is the store behind MemoryCache and the provider cache: a map into a linked list
+// ordered by insertion or use, with per-entry expiry and byte accounting.
+type lru[V any] struct {
+	mu       sync.Mutex
+	items    map[string]*list.Element
+	order    *list.List // front is the most recently stored entry, or used one with EvictLRU
+	maxSize  int
+	maxBytes int64
+	eviction EvictionPolicy
+	counts   CacheStats
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
-func newAggregatorCache(maxSize int, ttl time.Duration) *aggregatorCache {
-	return &aggregatorCache{
-		store:   make(map[string]cacheEntry),
-		maxSize: maxSize,
-		ttl:     ttl,
-		order:   make([]string, 0, maxSize),
+func newLRU[V any](maxSize int, maxBytes int64, eviction EvictionPolicy, sweepInterval time.Duration) *lru[V] {
+	c := &lru[V]{
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		maxSize:  maxSize,
+		maxBytes: maxBytes,
+		eviction: eviction,
+		stop:     make(chan struct{}),
+	}
+	if sweepInterval > 0 {
+		go c.sweepEvery(sweepInterval)
 	}
+	return c
 }
 
-func (c *aggregatorCache) Get(key string) (models.SearchResponse, bool) {
-	c.mu.RLock()
-	entry, ok := c.store[key]
-	c.mu.RUnlock()
-	if !ok || time.Now().After(entry.expiresAt) {
-		if ok {
-			c.mu.Lock()
-			delete(c.store, key)
-			c.removeOrder(key)
-			c.mu.Unlock()
-		}
-		return models.SearchResponse{}, false
+func (c *lru[V]) get(key string) (V, bool) {
+	var zero V
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		c.counts.Misses++
+		return zero, false
+	}
+	entry := elem.Value.(*lruEntry[V])
+	if time.Now().After(entry.expiresAt) {
+		c.remove(elem)
+		c.counts.Expirations++
+		c.counts.Misses++
+		return zero, false
+	}
+	if c.eviction == EvictLRU {
+		c.order.MoveToFront(elem)
 	}
+	c.counts.Hits++
 	return entry.value, true
 }
 
-func (c *aggregatorCache) Set(key string, value models.SearchResponse) {
+func (c *lru[V]) set(key string, value V, size int64, ttl time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if len(c.store) >= c.maxSize {
-		// Evict oldest
-		oldest := c.order[0]
-		delete(c.store, oldest)
-		c.order = c.order[1:]
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, size: size, expiresAt: time.Now().Add(ttl)})
+	c.counts.Bytes += size
+
+	for c.order.Len() > c.maxSize || (c.maxBytes > 0 && c.counts.Bytes > c.maxBytes) {
+		c.remove(c.order.Back())
+		c.counts.Evictions++
+	}
+}
+
+func (c *lru[V]) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.counts
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+func (c *lru[V]) close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+func (c *lru[V]) sweepEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.sweep()
+		case <-c.stop:
+			return
+		}
 	}
-	c.store[key] = cacheEntry{value: value, expiresAt: time.Now().Add(c.ttl)}
-	c.order = append(c.order, key)
 }
 
-func (c *aggregatorCache) removeOrder(key string) {
-	for i, k := range c.order {
-		if k == key {
-			c.order = append(c.order[:i], c.order[i+1:]...)
-			break
+// sweep drops every expired entry.
+func (c *lru[V]) sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for elem := c.order.Back(); elem != nil; {
+		prev := elem.Prev()
+		if now.After(elem.Value.(*lruEntry[V]).expiresAt) {
+			c.remove(elem)
+			c.counts.Expirations++
 		}
+		elem = prev
+	}
+}
+
+func (c *lru[V]) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*lruEntry[V])
+	delete(c.items, entry.key)
+	c.counts.Bytes -= entry.size
+}
+
+// encodedSize estimates the memory a cached value holds by its encoded size. Results
+// vary from a handful of flights to hundreds, so counting entries alone says little.
+func encodedSize(v interface{}) int64 {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
 	}
+	return int64(len(data))
 }
 
-var aggCache = newAggregatorCache(1000, 5*time.Minute) // 1000 entries, 5 min TTL
+// cacheKey identifies a one-way search by everything that shapes its results, hashed
+// from normalized values so requests that mean the same thing share an entry. The names
+// of the providers answering it are part of the key, so switching one off doesn't serve
+// its flights from earlier responses. Round-trip and flexible searches are assembled
+// from uncached legs, so ReturnDate and FlexDays play no part.
+func cacheKey(req models.SearchRequest, providers []string) string {
+	names := append([]string(nil), providers...)
+	sort.Strings(names)
+	sum := sha256.Sum256([]byte(routeKey(req) + "\x00" + filterKey(req) + "\x00" + strings.Join(names, "\x00")))
+	return "search:" + hex.EncodeToString(sum[:16])
+}
+
+// routeKey covers what providers are asked: route, date, passengers and cabin. Searches
+// that differ only in filters or sorting share it.
+func routeKey(req models.SearchRequest) string {
+	passengers := "1"
+	if n, err := strconv.Atoi(strings.TrimSpace(req.Passengers)); err == nil && n > 0 {
+		passengers = strconv.Itoa(n)
+	}
+	cabin := strings.ToLower(strings.TrimSpace(req.CabinClass))
+	if cabin == "" {
+		cabin = "economy"
+	}
+	return strings.Join([]string{
+		strings.ToUpper(strings.TrimSpace(req.Origin)),
+		strings.ToUpper(strings.TrimSpace(req.Destination)),
+		req.DepartureDate,
+		passengers,
+		cabin,
+	}, "|")
+}
+
+// filterKey covers what the pipeline does with the provider results. Unset and no-op
+// values are written the same way: a minimum of 0, a half-open time window (which
+// filters nothing), an empty airline list or sort order.
+func filterKey(req models.SearchRequest) string {
+	var b strings.Builder
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s=%s;", name, value)
+		}
+	}
+	min := func(p *int) string {
+		if p == nil || *p <= 0 {
+			return ""
+		}
+		return strconv.Itoa(*p)
+	}
+	max := func(p *int) string {
+		if p == nil {
+			return ""
+		}
+		return strconv.Itoa(*p)
+	}
+	window := func(start, end *string) string {
+		if start == nil || end == nil {
+			return ""
+		}
+		return *start + "-" + *end
+	}
+
+	field("min_price", min(req.MinPrice))
+	field("max_price", max(req.MaxPrice))
+	field("min_stops", min(req.MinStops))
+	field("max_stops", max(req.MaxStops))
+	field("departure", window(req.DepartureTimeStart, req.DepartureTimeEnd))
+	field("arrival", window(req.ArrivalTimeStart, req.ArrivalTimeEnd))
+	field("min_duration", min(req.MinDurationMinutes))
+	field("max_duration", max(req.MaxDurationMinutes))
 
-func cacheKey(req models.SearchRequest) string {
-	// Use a simple key: all fields concatenated (for demo, not for production)
-	return fmt.Sprintf("%s|%s|%s|%s|%s|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v",
-		req.Origin, req.Destination, req.DepartureDate, req.Passengers, req.CabinClass,
-		req.MinPrice, req.MaxPrice, req.MinStops, req.MaxStops,
-		req.DepartureTimeStart, req.DepartureTimeEnd, req.ArrivalTimeStart, req.ArrivalTimeEnd,
-		req.Airlines, req.MinDurationMinutes, req.MaxDurationMinutes, req.SortBy, req.ReturnDate)
-}
\ No newline at end of file
+	// Airlines match exactly, so only their order and repeats are normalized
+	airlines := make([]string, 0, len(req.Airlines))
+	seen := make(map[string]bool, len(req.Airlines))
+	for _, a := range req.Airlines {
+		if !seen[a] {
+			seen[a] = true
+			airlines = append(airlines, a)
+		}
+	}
+	sort.Strings(airlines)
+	field("airlines", strings.Join(airlines, ","))
+
+	if req.SortBy != nil {
+		field("sort", *req.SortBy)
+	}
+	return b.String()
+}
@@ -0,0 +1,212 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"flight-aggregator/models"
+)
+
+// searchGroup coalesces concurrent identical searches, so a burst of users on a cold
+// route shares one provider fan-out.
+type searchGroup struct {
+	mu    sync.Mutex
+	calls map[string]*searchCall
+}
+
+// searchCall is a search in flight and the callers waiting on it.
+type searchCall struct {
+	ctx     *sharedContext
+	done    chan struct{}
+	waiters map[int]time.Time // deadline of each caller still waiting, zero for none
+	nextID  int
+	resp    models.SearchResponse
+	err     error
+}
+
+// join registers a caller and stretches the shared deadline to cover it.
+func (c *searchCall) join(ctx context.Context) int {
+	id := c.nextID
+	c.nextID++
+	deadline, _ := ctx.Deadline()
+	c.waiters[id] = deadline
+	c.ctx.setDeadline(c.latestDeadline())
+	return id
+}
+
+// latestDeadline is the deadline the search needs to serve every caller still waiting,
+// zero when one of them has none.
+func (c *searchCall) latestDeadline() time.Time {
+	var latest time.Time
+	for _, d := range c.waiters {
+		if d.IsZero() {
+			return time.Time{}
+		}
+		if d.After(latest) {
+			latest = d
+		}
+	}
+	return latest
+}
+
+// do runs search once for all concurrent callers with the same key. The search gets a
+// context detached from the callers' cancellation whose deadline is the latest of the
+// callers still waiting, so one caller going away or timing out doesn't fail the others;
+// it is only cancelled once every caller has given up. A caller whose context ends
+// first returns its context error.
+func (g *searchGroup) do(ctx context.Context, key string, search func(context.Context) (models.SearchResponse, error)) (models.SearchResponse, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*searchCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		id := c.join(ctx)
+		g.mu.Unlock()
+		return g.wait(ctx, key, c, id)
+	}
+
+	c := &searchCall{ctx: newSharedContext(ctx), done: make(chan struct{}), waiters: make(map[int]time.Time)}
+	id := c.join(ctx)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	go g.run(key, c, search)
+	return g.wait(ctx, key, c, id)
+}
+
+func (g *searchGroup) run(key string, c *searchCall, search func(context.Context) (models.SearchResponse, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("search panicked: %v", r)
+		}
+		g.forget(key, c)
+		c.ctx.end(context.Canceled)
+		close(c.done)
+	}()
+	c.resp, c.err = search(c.ctx)
+}
+
+func (g *searchGroup) wait(ctx context.Context, key string, c *searchCall, id int) (models.SearchResponse, error) {
+	select {
+	case <-c.done:
+		return c.resp, c.err
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && !deadlineBefore(ctx, c.ctx) {
+		// The shared search hit the same deadline and is wrapping up with what it has
+		g.mu.Unlock()
+		<-c.done
+		return c.resp, c.err
+	}
+	delete(c.waiters, id)
+	if len(c.waiters) == 0 {
+		// Nobody is left to answer, and the next caller shouldn't join a dying search
+		c.ctx.end(context.Canceled)
+		g.forgetLocked(key, c)
+	} else {
+		c.ctx.setDeadline(c.latestDeadline())
+	}
+	g.mu.Unlock()
+	return models.SearchResponse{}, ctx.Err()
+}
+
+func (g *searchGroup) forget(key string, c *searchCall) {
+	g.mu.Lock()
+	g.forgetLocked(key, c)
+	g.mu.Unlock()
+}
+
+func (g *searchGroup) forgetLocked(key string, c *searchCall) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// sharedContext is the context of a coalesced search. It carries the values of the
+// caller that started it but not its cancellation, and its deadline moves as callers
+// join and leave.
+type sharedContext struct {
+	context.Context // the first caller's context without its cancellation, for values
+
+	mu       sync.Mutex
+	done     chan struct{}
+	err      error
+	deadline time.Time // zero for none
+	timer    *time.Timer
+}
+
+func newSharedContext(parent context.Context) *sharedContext {
+	return &sharedContext{Context: context.WithoutCancel(parent), done: make(chan struct{})}
+}
+
+func (c *sharedContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline, !c.deadline.IsZero()
+}
+
+func (c *sharedContext) Done() <-chan struct{} { return c.done }
+
+func (c *sharedContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// setDeadline moves the deadline, earlier or later; zero removes it.
+func (c *sharedContext) setDeadline(deadline time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil || deadline.Equal(c.deadline) {
+		return
+	}
+	c.deadline = deadline
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if deadline.IsZero() {
+		return
+	}
+	c.timer = time.AfterFunc(time.Until(deadline), func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// A timer stopped too late must not end a context whose deadline has moved on
+		if c.deadline.Equal(deadline) {
+			c.endLocked(context.DeadlineExceeded)
+		}
+	})
+}
+
+// end closes the context with err unless it has already ended.
+func (c *sharedContext) end(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.endLocked(err)
+}
+
+func (c *sharedContext) endLocked(err error) {
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+// deadlineBefore reports whether a has a deadline earlier than b's, or one where b has none.
+func deadlineBefore(a, b context.Context) bool {
+	da, okA := a.Deadline()
+	if !okA {
+		return false
+	}
+	db, okB := b.Deadline()
+	return !okB || da.Before(db)
+}
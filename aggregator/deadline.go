@@ -0,0 +1,101 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"flight-aggregator/models"
+	"flight-aggregator/providers"
+)
+
+// defaultWarmTimeout bounds background cache warming when SoftDeadline doesn't set one.
+const defaultWarmTimeout = 10 * time.Second
+
+// errSoftDeadline marks providers that had not answered within the soft deadline.
+var errSoftDeadline = fmt.Errorf("no answer within the soft deadline: %w", context.DeadlineExceeded)
+
+// SoftDeadline lets a search return what has arrived instead of waiting for every provider.
+type SoftDeadline struct {
+	Budget      time.Duration // how long to wait for providers, 0 disables the soft deadline
+	WarmCache   bool          // let stragglers finish in the background and cache the full result
+	WarmTimeout time.Duration // bound on background warming, defaults to 10s
+}
+
+// WithSoftDeadline returns partial results once the budget is spent, or when the search
+// context ends with at least one provider answered. Providers still pending are
+// reported as timed out and the response is marked partial. Partial results are not
+// cached, but with WarmCache the complete result is cached once the stragglers finish.
+func WithSoftDeadline(cfg SoftDeadline) Option {
+	return func(s *AggregatorService) {
+		s.softDeadline = cfg
+	}
+}
+
+func (s *AggregatorService) fetchWithSoftDeadline(ctx context.Context, provs []providers.Provider, req models.SearchRequest) fetchResult {
+	start := time.Now()
+	fetchCtx, cancel := ctx, context.CancelFunc(func() {})
+	if s.softDeadline.WarmCache {
+		// Stragglers must outlive the search to warm the cache
+		timeout := s.softDeadline.WarmTimeout
+		if timeout <= 0 {
+			timeout = defaultWarmTimeout
+		}
+		fetchCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	}
+
+	results := s.queryProviders(fetchCtx, provs, req)
+	c := newCollector(provs)
+	timer := time.NewTimer(s.softDeadline.Budget)
+	defer timer.Stop()
+	for {
+		select {
+		case res, ok := <-results:
+			if !ok {
+				cancel()
+				return c.result()
+			}
+			c.add(res)
+		case <-timer.C:
+			return s.cutShort(c, results, req, start, cancel, errSoftDeadline)
+		case <-ctx.Done():
+			return s.cutShort(c, results, req, start, cancel, ctx.Err())
+		}
+	}
+}
+
+// cutShort stops waiting for the remaining providers and hands them to the cache warmer.
+func (s *AggregatorService) cutShort(c *collector, pending <-chan providerResult, req models.SearchRequest, start time.Time, cancel context.CancelFunc, err error) fetchResult {
+	fetched := c.result()
+	fetched.partial = true
+	markPending(fetched.statuses, err)
+	if s.softDeadline.WarmCache {
+		go s.warmCache(c, pending, req, start, cancel)
+	} else {
+		cancel()
+	}
+	return fetched
+}
+
+// warmCache waits for the stragglers and caches the complete result for the next search.
+// Stragglers that answered are in the provider cache either way.
+func (s *AggregatorService) warmCache(c *collector, pending <-chan providerResult, req models.SearchRequest, start time.Time, cancel context.CancelFunc) {
+	defer cancel()
+	for res := range pending {
+		c.add(res)
+	}
+	fetched := c.result()
+	if !fetched.complete() || s.needsConnections(fetched.flights, req) {
+		// Connections need the hub legs, which the next search fetches
+		return
+	}
+	flights, err := s.pipeline(fetched.flights, req)
+	if err != nil {
+		return
+	}
+	s.cache.Set(cacheKey(req, fetched.providers()), models.SearchResponse{
+		SearchCriteria: req,
+		Metadata:       s.metadata(len(flights), fetched, start),
+		Flights:        flights,
+	})
+}
@@ -0,0 +1,69 @@
+package aggregator
+
+import (
+	"errors"
+
+	"flight-aggregator/providers"
+)
+
+// ErrUnknownProvider is returned when enabling or disabling a provider that isn't configured.
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// WithDisabledProviders starts the named providers switched off.
+func WithDisabledProviders(names ...string) Option {
+	return func(s *AggregatorService) {
+		for _, name := range names {
+			s.disabled[name] = true
+		}
+	}
+}
+
+// SetProviderEnabled switches a provider on or off for searches started from now on.
+func (s *AggregatorService) SetProviderEnabled(name string, enabled bool) error {
+	found := false
+	for _, p := range s.providers {
+		if p.Name() == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrUnknownProvider
+	}
+
+	s.disabledMu.Lock()
+	defer s.disabledMu.Unlock()
+	if enabled {
+		delete(s.disabled, name)
+	} else {
+		s.disabled[name] = true
+	}
+	return nil
+}
+
+func (s *AggregatorService) providerEnabled(name string) bool {
+	s.disabledMu.RLock()
+	defer s.disabledMu.RUnlock()
+	return !s.disabled[name]
+}
+
+func providerNames(provs []providers.Provider) []string {
+	names := make([]string, len(provs))
+	for i, p := range provs {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// activeProviders is the set of enabled providers a search should query.
+func (s *AggregatorService) activeProviders() []providers.Provider {
+	s.disabledMu.RLock()
+	defer s.disabledMu.RUnlock()
+	active := make([]providers.Provider, 0, len(s.providers))
+	for _, p := range s.providers {
+		if !s.disabled[p.Name()] {
+			active = append(active, p)
+		}
+	}
+	return active
+}
@@ -0,0 +1,89 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"flight-aggregator/models"
+)
+
+// defaultFlexDays is used when a flexible search doesn't set flex_days.
+const defaultFlexDays = 3
+
+// SearchFlexible searches every date within ±FlexDays of DepartureDate concurrently and
+// summarises each day in a fare calendar. Dates before today are skipped. At most
+// maxParallelFetches provider calls run at once across all dates.
+func (s *AggregatorService) SearchFlexible(ctx context.Context, req models.SearchRequest) (models.FlexibleSearchResponse, error) {
+	start := time.Now()
+	if err := req.Validate(s.now()); err != nil {
+		return models.FlexibleSearchResponse{SearchCriteria: req}, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	flexDays := defaultFlexDays
+	if req.FlexDays != nil {
+		flexDays = *req.FlexDays
+	}
+	dates := flexDates(req.DepartureDate, flexDays, s.now())
+
+	dayReqs := make([]models.SearchRequest, len(dates))
+	for i, date := range dates {
+		dayReqs[i] = req
+		dayReqs[i].DepartureDate = date
+	}
+	results := s.searchLegs(ctx, s.activeProviders(), dayReqs)
+
+	resp := models.FlexibleSearchResponse{SearchCriteria: req, Calendar: make([]models.FareCalendarDay, len(dates))}
+	var selected legResult
+	for i, date := range dates {
+		day := fareCalendarDay(date, results[i])
+		day.Selected = date == req.DepartureDate
+		resp.Calendar[i] = day
+		if day.Selected {
+			selected = results[i]
+		}
+	}
+
+	resp.Metadata = s.metadata(0, selected.fetched, start)
+	if selected.err != nil {
+		return resp, selected.err
+	}
+	resp.Flights = selected.flights
+	resp.Metadata = s.metadata(len(selected.flights), selected.fetched, start)
+	return resp, nil
+}
+
+// flexDates lists the days from date-flexDays to date+flexDays, leaving out days before today.
+func flexDates(date string, flexDays int, now time.Time) []string {
+	center, _ := time.Parse("2006-01-02", date)
+	today := now.Format("2006-01-02")
+	var dates []string
+	for d := -flexDays; d <= flexDays; d++ {
+		day := center.AddDate(0, 0, d).Format("2006-01-02")
+		if day < today {
+			continue
+		}
+		dates = append(dates, day)
+	}
+	return dates
+}
+
+// fareCalendarDay summarises one day's search. A day that failed is marked so it isn't
+// mistaken for a day without flights.
+func fareCalendarDay(date string, res legResult) models.FareCalendarDay {
+	day := models.FareCalendarDay{Date: date, Status: models.DayOK, FlightCount: len(res.flights)}
+	if res.err != nil {
+		day.Status = models.DayFailed
+		day.ErrorCode = classifyError(res.err)
+		day.Error = res.err.Error()
+		return day
+	}
+	for _, f := range res.flights {
+		if day.CheapestPrice == nil || f.Price.Amount < day.CheapestPrice.Amount {
+			price := f.Price
+			day.CheapestPrice = &price
+			day.CheapestAirline = f.Airline.Name
+		}
+	}
+	return day
+}
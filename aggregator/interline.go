@@ -0,0 +1,198 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"flight-aggregator/airports"
+	"flight-aggregator/models"
+)
+
+// ConnectionRule bounds the ground time allowed when changing flights at an airport.
+type ConnectionRule struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// InterlineConfig controls virtual interlining: stitching separately ticketed flights,
+// possibly from different providers, into one-stop connections when a route has no
+// direct service.
+type InterlineConfig struct {
+	Enabled  bool
+	Default  ConnectionRule
+	Airports map[string]ConnectionRule // per connecting airport overrides, keyed by IATA code
+	Hubs     []string                  // connecting airports whose legs are fetched when a route has no direct flights
+}
+
+// DefaultInterlineConfig allows self-transfers with 90 minutes to 6 hours on the ground,
+// connecting through the domestic hubs. Self-transfers need longer minimums than
+// protected connections since bags are collected and checked in again.
+func DefaultInterlineConfig() InterlineConfig {
+	return InterlineConfig{
+		Enabled: true,
+		Default: ConnectionRule{Min: 90 * time.Minute, Max: 6 * time.Hour},
+		Hubs:    airports.Hubs(),
+	}
+}
+
+// WithInterlining replaces the virtual interlining configuration.
+func WithInterlining(cfg InterlineConfig) Option {
+	return func(s *AggregatorService) {
+		s.interline = cfg
+	}
+}
+
+func (c InterlineConfig) rule(airport string) ConnectionRule {
+	if r, ok := c.Airports[airport]; ok {
+		return r
+	}
+	return c.Default
+}
+
+// needsConnections reports whether interlining has to stitch flights for the route,
+// because none of flights serve it directly.
+func (s *AggregatorService) needsConnections(flights []models.Flight, req models.SearchRequest) bool {
+	if !s.interline.Enabled {
+		return false
+	}
+	for _, f := range flights {
+		if airports.Matches(req.Origin, f.Departure.Airport) && airports.Matches(req.Destination, f.Arrival.Airport) {
+			return false
+		}
+	}
+	return true
+}
+
+// connectingLegs adds the origin→hub and hub→destination flights of every configured
+// hub when the route has no direct flights. Providers only answer the route they are
+// asked for, so interlining has nothing to stitch without them. Only providers that
+// answered the route are asked, in one fan-out bounded like any search and within what
+// is left of the soft deadline budget counted from start; a partial fetch has spent it
+// already. Legs that fail are left out; the calls made are counted in each provider's
+// HubAttempts.
+func (s *AggregatorService) connectingLegs(ctx context.Context, fetched fetchResult, req models.SearchRequest, start time.Time) fetchResult {
+	if fetched.partial || !s.needsConnections(fetched.flights, req) {
+		return fetched
+	}
+	if budget := s.softDeadline.Budget; budget > 0 {
+		remaining := time.Until(start.Add(budget))
+		if remaining <= 0 {
+			return fetched
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, remaining)
+		defer cancel()
+	}
+
+	answered := make(map[string]bool, len(fetched.statuses))
+	for _, st := range fetched.statuses {
+		answered[st.Name] = st.Status == models.ProviderOK
+	}
+	var tasks []providerTask
+	for _, hub := range s.interline.Hubs {
+		if airports.Matches(req.Origin, hub) || airports.Matches(req.Destination, hub) {
+			continue
+		}
+		first, second := req, req
+		first.Destination = hub
+		second.Origin = hub
+		for _, p := range s.providers {
+			if answered[p.Name()] {
+				tasks = append(tasks, providerTask{prov: p, req: first}, providerTask{prov: p, req: second})
+			}
+		}
+	}
+	if len(tasks) == 0 {
+		return fetched
+	}
+
+	found := make([][]models.Flight, len(tasks))
+	attempts := make(map[string]int)
+	for res := range s.queryTasks(ctx, tasks) {
+		found[res.index] = res.flights
+		attempts[res.status.Name] += res.status.Attempts
+	}
+	fetched.statuses = append([]models.ProviderStatus(nil), fetched.statuses...)
+	for i := range fetched.statuses {
+		fetched.statuses[i].HubAttempts += attempts[fetched.statuses[i].Name]
+	}
+	for _, fl := range found {
+		fetched.flights = append(fetched.flights, fl...)
+	}
+	return fetched
+}
+
+// interlineFlights appends self-transfer connections to flights when none of them
+// serve the requested route directly.
+func (s *AggregatorService) interlineFlights(flights []models.Flight, req models.SearchRequest) []models.Flight {
+	if !s.needsConnections(flights, req) {
+		return flights
+	}
+
+	var firstLegs, secondLegs []models.Flight
+	for _, f := range flights {
+		fromOrigin := airports.Matches(req.Origin, f.Departure.Airport)
+		toDestination := airports.Matches(req.Destination, f.Arrival.Airport)
+		switch {
+		case fromOrigin:
+			firstLegs = append(firstLegs, f)
+		case toDestination:
+			secondLegs = append(secondLegs, f)
+		}
+	}
+
+	for _, first := range firstLegs {
+		for _, second := range secondLegs {
+			if second.Departure.Airport != first.Arrival.Airport {
+				continue
+			}
+			rule := s.interline.rule(first.Arrival.Airport)
+			ground := time.Duration(second.Departure.Timestamp-first.Arrival.Timestamp) * time.Second
+			if ground < rule.Min || ground > rule.Max {
+				continue
+			}
+			flights = append(flights, connectFlights(first, second))
+		}
+	}
+	return flights
+}
+
+// connectFlights builds a single self-transfer flight out of two separately booked ones.
+// The first flight's airline is kept as the marketing airline.
+func connectFlights(first, second models.Flight) models.Flight {
+	provider := first.Provider
+	if second.Provider != first.Provider {
+		provider += " + " + second.Provider
+	}
+	seats := first.AvailableSeats
+	if second.AvailableSeats < seats {
+		seats = second.AvailableSeats
+	}
+	mins := int((second.Arrival.Timestamp - first.Departure.Timestamp) / 60)
+
+	conn := models.Flight{
+		ID:             first.ID + "+" + second.ID,
+		Provider:       provider,
+		Airline:        first.Airline,
+		FlightNumber:   first.FlightNumber + "/" + second.FlightNumber,
+		Departure:      first.Departure,
+		Arrival:        second.Arrival,
+		Duration:       models.Duration{TotalMinutes: mins, Formatted: fmt.Sprintf("%dh %dm", mins/60, mins%60)},
+		Stops:          first.Stops + second.Stops + 1,
+		Price:          models.Price{Amount: first.Price.Amount + second.Price.Amount, Currency: first.Price.Currency},
+		AvailableSeats: seats,
+		CabinClass:     first.CabinClass,
+		Baggage:        first.Baggage,
+		SelfTransfer:   true,
+	}
+
+	// Segments are only meaningful when both flights describe all their legs
+	if len(first.Segments) > 0 && len(second.Segments) > 0 {
+		conn.Segments = append(append(conn.Segments, first.Segments...), second.Segments...)
+	}
+	conn.Layovers = append(conn.Layovers, first.Layovers...)
+	conn.Layovers = append(conn.Layovers, models.NewLayover(first.Arrival, second.Departure, 0))
+	conn.Layovers = append(conn.Layovers, second.Layovers...)
+	return conn
+}
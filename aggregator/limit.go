@@ -0,0 +1,35 @@
+package aggregator
+
+import "context"
+
+// fetchSlots bounds the provider calls in flight for one search, across everything it
+// fans out to: its providers, the airports of a city code, the hub legs of a
+// connection and every leg or date of a multi-leg search.
+type fetchSlots chan struct{}
+
+type fetchSlotsKey struct{}
+
+// withFetchSlots bounds the provider calls made under ctx to maxParallelFetches, unless
+// ctx already carries a bound from the search it belongs to.
+func (s *AggregatorService) withFetchSlots(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(fetchSlotsKey{}).(fetchSlots); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, fetchSlotsKey{}, make(fetchSlots, s.maxParallelFetches))
+}
+
+// acquireFetchSlot waits for room to make a provider call and returns the func that
+// gives it back. A slot is only held for the call itself, never while waiting on
+// anything else, so searches sharing the slots can't deadlock.
+func acquireFetchSlot(ctx context.Context) (func(), error) {
+	slots, ok := ctx.Value(fetchSlotsKey{}).(fetchSlots)
+	if !ok {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,143 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"flight-aggregator/models"
+)
+
+const (
+	// defaultMinConnection applies when a multi-city request doesn't set its own.
+	defaultMinConnection = 2 * time.Hour
+	// maxFlightsPerLeg bounds the combinations explored per leg, best ranked first.
+	maxFlightsPerLeg = 10
+	// maxCombinations bounds the product of candidates across legs, so six legs of ten
+	// flights don't walk a million itineraries.
+	maxCombinations = 20000
+	// maxItineraries caps the number of itineraries returned.
+	maxItineraries = 50
+)
+
+// SearchMultiCity fans out every leg over the providers concurrently, runs each through
+// the regular pipeline and combines them into itineraries that respect the minimum
+// connection time between landing and the next departure.
+func (s *AggregatorService) SearchMultiCity(ctx context.Context, req models.MultiCityRequest) (models.MultiCityResponse, error) {
+	start := time.Now()
+	if err := req.Validate(s.now()); err != nil {
+		return models.MultiCityResponse{SearchCriteria: req}, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	legReqs := make([]models.SearchRequest, len(req.Legs))
+	for i := range req.Legs {
+		legReqs[i] = req.LegRequest(i)
+	}
+	legs := s.searchLegs(ctx, s.activeProviders(), legReqs)
+
+	fetched := mergeFetches(legs)
+	resp := models.MultiCityResponse{SearchCriteria: req, Metadata: s.metadata(0, fetched, start)}
+	for _, leg := range legs {
+		if leg.err != nil {
+			return resp, leg.err
+		}
+	}
+
+	minConnection := defaultMinConnection
+	if req.MinConnectionMinutes != nil {
+		minConnection = time.Duration(*req.MinConnectionMinutes) * time.Minute
+	}
+
+	candidates := make([][]models.Flight, len(legs))
+	for i, leg := range legs {
+		candidates[i] = leg.flights
+		if len(candidates[i]) > maxFlightsPerLeg {
+			candidates[i] = candidates[i][:maxFlightsPerLeg]
+		}
+	}
+	capCombinations(candidates, maxCombinations)
+
+	best := newTopCombinations[models.Itinerary](maxItineraries, req.SortBy)
+	combineLegs(candidates, minConnection, nil, func(flights []models.Flight) {
+		key := itineraryKey(flights)
+		if req.MinPrice != nil && key.price < *req.MinPrice {
+			return
+		}
+		if req.MaxPrice != nil && key.price > *req.MaxPrice {
+			return
+		}
+		best.offer(key, func() models.Itinerary {
+			// flights is reused by the walk, so a kept itinerary needs its own copy
+			return newItinerary(append([]models.Flight(nil), flights...))
+		})
+	})
+	itineraries := best.sorted()
+
+	resp.Itineraries = itineraries
+	resp.Metadata = s.metadata(len(itineraries), fetched, start)
+	return resp, nil
+}
+
+// capCombinations trims the longest candidate lists, dropping their worst ranked flights,
+// until the number of combinations across legs is at most limit.
+func capCombinations(candidates [][]models.Flight, limit int) {
+	for {
+		product, longest := 1, 0
+		for i, c := range candidates {
+			product *= len(c)
+			if len(c) > len(candidates[longest]) {
+				longest = i
+			}
+		}
+		if product <= limit || len(candidates[longest]) <= 1 {
+			return
+		}
+		candidates[longest] = candidates[longest][:len(candidates[longest])-1]
+	}
+}
+
+// combineLegs walks every choice of one flight per leg, pruning branches whose next
+// departure leaves less than minConnection after the previous arrival. The slice passed
+// to emit is reused; emit must copy it to keep it.
+func combineLegs(candidates [][]models.Flight, minConnection time.Duration, chosen []models.Flight, emit func([]models.Flight)) {
+	if len(chosen) == len(candidates) {
+		emit(chosen)
+		return
+	}
+	for _, f := range candidates[len(chosen)] {
+		if n := len(chosen); n > 0 && f.Departure.Timestamp < chosen[n-1].Arrival.Timestamp+int64(minConnection.Seconds()) {
+			continue
+		}
+		combineLegs(candidates, minConnection, append(chosen, f), emit)
+	}
+}
+
+// itineraryKey ranks a choice of flights without building the itinerary.
+func itineraryKey(flights []models.Flight) comboKey {
+	var k comboKey
+	for _, f := range flights {
+		k.price += f.Price.Amount
+		k.minutes += f.Duration.TotalMinutes
+		k.stops += f.Stops
+	}
+	k.departure = flights[0].Departure.Timestamp
+	k.arrival = flights[len(flights)-1].Arrival.Timestamp
+	return k
+}
+
+func newItinerary(flights []models.Flight) models.Itinerary {
+	ids := make([]string, len(flights))
+	total, mins := 0, 0
+	for i, f := range flights {
+		ids[i] = f.ID
+		total += f.Price.Amount
+		mins += f.Duration.TotalMinutes
+	}
+	return models.Itinerary{
+		ID:            strings.Join(ids, "|"),
+		Flights:       flights,
+		TotalPrice:    models.Price{Amount: total, Currency: flights[0].Price.Currency},
+		TotalDuration: models.Duration{TotalMinutes: mins, Formatted: fmt.Sprintf("%dh %dm", mins/60, mins%60)},
+	}
+}
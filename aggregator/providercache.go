@@ -0,0 +1,75 @@
+package aggregator
+
+import (
+	"time"
+
+	"flight-aggregator/models"
+)
+
+// ProviderCacheOptions tunes the cache of raw provider results. It sits below the
+// response cache: a search that only changes filters or sorting reruns the pipeline on
+// cached flights, and a provider that failed is the only one fetched again.
+type ProviderCacheOptions struct {
+	TTL         time.Duration            // how long a provider's flights for a route are reused, 0 turns the cache off
+	ProviderTTL map[string]time.Duration // per provider name, overriding TTL; 0 or less never caches that provider
+	MaxSize     int                      // route results kept across all providers, defaults to 5000
+	MaxBytes    int64                    // total encoded size of the flights kept, 0 for no limit
+}
+
+// DefaultProviderCacheOptions reuses a provider's flights for a minute.
+func DefaultProviderCacheOptions() ProviderCacheOptions {
+	return ProviderCacheOptions{TTL: time.Minute, MaxSize: 5000}
+}
+
+// WithProviderCache replaces the provider cache configuration.
+func WithProviderCache(opts ProviderCacheOptions) Option {
+	return func(s *AggregatorService) {
+		s.providerCache = newProviderCache(opts)
+	}
+}
+
+// providerCache keeps each provider's successful answers by provider and route.
+type providerCache struct {
+	opts  ProviderCacheOptions
+	store *lru[[]models.Flight]
+}
+
+func newProviderCache(opts ProviderCacheOptions) *providerCache {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultProviderCacheOptions().MaxSize
+	}
+	return &providerCache{opts: opts, store: newLRU[[]models.Flight](opts.MaxSize, opts.MaxBytes, EvictLRU, 0)}
+}
+
+func (c *providerCache) ttl(provider string) time.Duration {
+	if ttl, ok := c.opts.ProviderTTL[provider]; ok {
+		return ttl
+	}
+	return c.opts.TTL
+}
+
+func providerCacheKey(provider string, req models.SearchRequest) string {
+	return provider + "\x00" + routeKey(req)
+}
+
+// get returns the flights a provider last answered for the request's route. Cached
+// slices are shared, which is fine as the collector copies them out.
+func (c *providerCache) get(provider string, req models.SearchRequest) ([]models.Flight, bool) {
+	if c.ttl(provider) <= 0 {
+		return nil, false
+	}
+	return c.store.get(providerCacheKey(provider, req))
+}
+
+func (c *providerCache) set(provider string, req models.SearchRequest, flights []models.Flight) {
+	ttl := c.ttl(provider)
+	if ttl <= 0 {
+		return
+	}
+	c.store.set(providerCacheKey(provider, req), flights, encodedSize(flights), ttl)
+}
+
+// ProviderCacheStats reports the counters of the provider cache.
+func (s *AggregatorService) ProviderCacheStats() CacheStats {
+	return s.providerCache.store.stats()
+}
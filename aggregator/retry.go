@@ -0,0 +1,143 @@
+package aggregator
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"flight-aggregator/models"
+	"flight-aggregator/providers"
+)
+
+// RetryPolicy controls how a provider call is retried.
+type RetryPolicy struct {
+	MaxAttempts    int           // total calls including the first, at least 1
+	BaseDelay      time.Duration // wait before the first retry
+	MaxDelay       time.Duration // cap on a single wait, 0 for none
+	Multiplier     float64       // growth of the wait per retry, 1 for constant backoff
+	Jitter         float64       // fraction of each wait that is randomised, 0 to 1
+	AttemptTimeout time.Duration // bound on a single call, 0 for none
+	Budget         time.Duration // bound on all attempts and waits together, 0 for none
+}
+
+// DefaultRetryPolicy makes up to 3 calls, waiting about 100ms then 200ms in between.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+		Multiplier:  2,
+		Jitter:      0.2,
+	}
+}
+
+// WithRetryPolicy replaces the retry policy used for providers without their own.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(s *AggregatorService) {
+		s.retry = p
+	}
+}
+
+// WithProviderRetryPolicy sets the retry policy for the provider with the given name.
+func WithProviderRetryPolicy(name string, p RetryPolicy) Option {
+	return func(s *AggregatorService) {
+		if s.providerRetry == nil {
+			s.providerRetry = make(map[string]RetryPolicy)
+		}
+		s.providerRetry[name] = p
+	}
+}
+
+func (s *AggregatorService) retryPolicy(provider string) RetryPolicy {
+	if p, ok := s.providerRetry[provider]; ok {
+		return p
+	}
+	return s.retry
+}
+
+// backoff returns the wait before the given retry, counting from 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.BaseDelay)
+	for i := 1; i < retry; i++ {
+		d *= p.Multiplier
+		if p.MaxDelay > 0 && d >= float64(p.MaxDelay) {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// fetchWithRetry calls the provider according to its retry policy and reports how many
+// calls it made. Only retryable errors are retried and a rate-limited provider's
+// retry-after is honoured. Each call takes one of the search's fetch slots, which is
+// given back during the wait before a retry. Every wait is cut short by ctx, and no
+// retry is started when the wait alone would outlast the deadline.
+func (s *AggregatorService) fetchWithRetry(ctx context.Context, prov providers.Provider, req models.SearchRequest) ([]models.Flight, int, error) {
+	policy := s.retryPolicy(prov.Name())
+	if policy.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Budget)
+		defer cancel()
+	}
+
+	var flights []models.Flight
+	var err error
+	attempts := 0
+	for {
+		release, slotErr := acquireFetchSlot(ctx)
+		if slotErr != nil {
+			err = slotErr
+			break
+		}
+		attempts++
+		flights, err = fetchAttempt(ctx, prov, req, policy.AttemptTimeout)
+		release()
+		if err == nil || attempts >= policy.MaxAttempts || !providers.IsRetryable(err) {
+			break
+		}
+		wait := policy.backoff(attempts)
+		if after := providers.RetryAfter(err); after > wait {
+			wait = after
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			break
+		}
+		if !sleepContext(ctx, wait) {
+			break
+		}
+	}
+	return flights, attempts, err
+}
+
+// fetchAttempt makes a single provider call bounded by timeout. A call that runs out of
+// its own time, while the search still has some, is a retryable failure.
+func fetchAttempt(ctx context.Context, prov providers.Provider, req models.SearchRequest, timeout time.Duration) ([]models.Flight, error) {
+	if timeout <= 0 {
+		return prov.FetchFlights(ctx, req)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	flights, err := prov.FetchFlights(attemptCtx, req)
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+		err = providers.Errorf(providers.KindUnavailable, "attempt timed out after %v: %w", timeout, context.DeadlineExceeded)
+	}
+	return flights, err
+}
+
+// sleepContext waits for d, returning false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
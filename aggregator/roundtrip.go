@@ -0,0 +1,308 @@
+package aggregator
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"flight-aggregator/fanout"
+	"flight-aggregator/models"
+	"flight-aggregator/providers"
+)
+
+const (
+	// minTurnaround is the shortest gap allowed between landing and flying back.
+	minTurnaround = 2 * time.Hour
+	// maxRoundTripOptions caps the number of priced combinations returned.
+	maxRoundTripOptions = 50
+)
+
+type legResult struct {
+	flights []models.Flight
+	fetched fetchResult
+	err     error
+}
+
+// mergeFetches merges the provider outcomes of several legs by provider name. A provider
+// only counts as succeeded when it answered every leg, and as skipped when its breaker
+// was open for any. Attempts and flights are summed, the slowest leg's latency is kept,
+// and it only counts as cached when every leg came from the provider cache.
+func mergeFetches(legs []legResult) fetchResult {
+	var merged fetchResult
+	index := make(map[string]int)
+	for _, leg := range legs {
+		merged.partial = merged.partial || leg.fetched.partial
+		for _, st := range leg.fetched.statuses {
+			i, ok := index[st.Name]
+			if !ok {
+				index[st.Name] = len(merged.statuses)
+				merged.statuses = append(merged.statuses, st)
+				continue
+			}
+			m := &merged.statuses[i]
+			m.Attempts += st.Attempts
+			m.HubAttempts += st.HubAttempts
+			m.FlightCount += st.FlightCount
+			m.Cached = m.Cached && st.Cached
+			if st.LatencyMs > m.LatencyMs {
+				m.LatencyMs = st.LatencyMs
+			}
+			if m.Status == models.ProviderSkipped || st.Status == models.ProviderOK {
+				continue
+			}
+			if st.Status == models.ProviderSkipped || m.Status == models.ProviderOK {
+				m.Status, m.ErrorCode, m.Error = st.Status, st.ErrorCode, st.Error
+			}
+		}
+	}
+	return merged
+}
+
+// SearchRoundTrip fetches the outbound and inbound legs concurrently and prices every
+// valid pairing, both same-carrier and mixed. Price filters apply to the combined
+// fare, every other filter applies to each leg.
+func (s *AggregatorService) SearchRoundTrip(ctx context.Context, req models.SearchRequest) (models.RoundTripResponse, error) {
+	start := time.Now()
+	if err := req.Validate(s.now()); err != nil {
+		return models.RoundTripResponse{SearchCriteria: req}, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+	if req.ReturnDate == nil {
+		verr := &models.ValidationError{}
+		verr.Add("returnDate", models.CodeRequired, "is required for round-trip searches")
+		return models.RoundTripResponse{SearchCriteria: req}, fmt.Errorf("%w: %w", ErrInvalidRequest, verr)
+	}
+
+	outReq, inReq := roundTripLegs(req)
+	legs := s.searchLegs(ctx, s.activeProviders(), []models.SearchRequest{outReq, inReq})
+	outbound, inbound := legs[0], legs[1]
+
+	fetched := mergeFetches([]legResult{outbound, inbound})
+	resp := models.RoundTripResponse{SearchCriteria: req, Metadata: s.metadata(0, fetched, start)}
+
+	for _, leg := range []legResult{outbound, inbound} {
+		if leg.err != nil {
+			return resp, leg.err
+		}
+	}
+
+	options := pairRoundTrips(outbound.flights, inbound.flights, req)
+
+	resp.Outbound = outbound.flights
+	resp.Inbound = inbound.flights
+	resp.Options = options
+	resp.Metadata = s.metadata(len(options), fetched, start)
+	return resp, nil
+}
+
+// searchLeg fetches and processes a single one-way leg from provs without touching the cache.
+func (s *AggregatorService) searchLeg(ctx context.Context, provs []providers.Provider, req models.SearchRequest) legResult {
+	start := time.Now()
+	fetched, err := s.fetchFromProviders(ctx, provs, req)
+	if err == nil {
+		err = s.fetchErr(ctx, fetched)
+	}
+	if err != nil {
+		return legResult{fetched: fetched, err: err}
+	}
+	fetched = s.connectingLegs(ctx, fetched, req, start)
+	flights, err := s.pipeline(fetched.flights, req)
+	return legResult{flights: flights, fetched: fetched, err: err}
+}
+
+// searchLegs searches every request concurrently and returns the results in request
+// order. Every request asks the same provs, taken once so a provider switched on or
+// off meanwhile can't make the legs disagree. The requests share one set of fetch
+// slots, so together they make at most maxParallelFetches provider calls at once.
+func (s *AggregatorService) searchLegs(ctx context.Context, provs []providers.Provider, reqs []models.SearchRequest) []legResult {
+	ctx = s.withFetchSlots(ctx)
+	legs := make([]legResult, len(reqs))
+	results := fanout.Run(ctx, len(reqs), 0, func(ctx context.Context, i int) (legResult, error) {
+		return s.searchLeg(ctx, provs, reqs[i]), nil
+	})
+	for res := range results {
+		legs[res.Index] = res.Value
+		if res.Err != nil {
+			legs[res.Index] = legResult{err: res.Err}
+		}
+	}
+	return legs
+}
+
+// roundTripLegs splits a round-trip request into one-way requests for each direction.
+func roundTripLegs(req models.SearchRequest) (models.SearchRequest, models.SearchRequest) {
+	out := req
+	out.ReturnDate = nil
+	out.MinPrice, out.MaxPrice = nil, nil
+
+	in := out
+	in.Origin, in.Destination = req.Destination, req.Origin
+	in.DepartureDate = *req.ReturnDate
+	return out, in
+}
+
+// pairRoundTrips combines every outbound with every inbound that leaves at least
+// minTurnaround after landing, applying the price filters to the combined fare. Only
+// the best maxRoundTripOptions are built, ranked like any other combination.
+func pairRoundTrips(outbound, inbound []models.Flight, req models.SearchRequest) []models.RoundTripOption {
+	best := newTopCombinations[models.RoundTripOption](maxRoundTripOptions, req.SortBy)
+	for _, out := range outbound {
+		for _, in := range inbound {
+			if in.Departure.Timestamp < out.Arrival.Timestamp+int64(minTurnaround.Seconds()) {
+				continue
+			}
+			total := out.Price.Amount + in.Price.Amount
+			if req.MinPrice != nil && total < *req.MinPrice {
+				continue
+			}
+			if req.MaxPrice != nil && total > *req.MaxPrice {
+				continue
+			}
+			// Departure sorts use the outbound leg, arrival sorts the inbound leg
+			key := comboKey{
+				price:     total,
+				minutes:   out.Duration.TotalMinutes + in.Duration.TotalMinutes,
+				stops:     out.Stops + in.Stops,
+				departure: out.Departure.Timestamp,
+				arrival:   in.Arrival.Timestamp,
+			}
+			best.offer(key, func() models.RoundTripOption {
+				return newRoundTripOption(out, in)
+			})
+		}
+	}
+	return best.sorted()
+}
+
+func newRoundTripOption(out, in models.Flight) models.RoundTripOption {
+	mins := out.Duration.TotalMinutes + in.Duration.TotalMinutes
+	return models.RoundTripOption{
+		ID:            out.ID + "|" + in.ID,
+		Outbound:      out,
+		Inbound:       in,
+		TotalPrice:    models.Price{Amount: out.Price.Amount + in.Price.Amount, Currency: out.Price.Currency},
+		TotalDuration: models.Duration{TotalMinutes: mins, Formatted: fmt.Sprintf("%dh %dm", mins/60, mins%60)},
+		SameCarrier:   out.Airline.Code == in.Airline.Code,
+	}
+}
+
+// comboKey holds the values used to rank results made of several flights.
+type comboKey struct {
+	price     int
+	minutes   int
+	stops     int
+	departure int64 // first departure
+	arrival   int64 // last arrival
+}
+
+// topCombinations keeps the best n results offered, ranked by the same best-value score
+// as rankFlights with the user's sort_by on top. They sit in a heap with the worst on
+// top, so walking every combination holds at most n of them.
+type topCombinations[T any] struct {
+	n     int
+	less  func(a, b comboKey) bool
+	items []rankedCombination[T]
+	seq   int
+}
+
+type rankedCombination[T any] struct {
+	value T
+	key   comboKey
+	seq   int // offer order, breaking ties the way a stable sort would
+}
+
+func newTopCombinations[T any](n int, sortBy *string) *topCombinations[T] {
+	return &topCombinations[T]{n: n, less: comboLess(sortBy)}
+}
+
+func (t *topCombinations[T]) Len() int           { return len(t.items) }
+func (t *topCombinations[T]) Less(i, j int) bool { return t.before(t.items[j], t.items[i]) }
+func (t *topCombinations[T]) Swap(i, j int)      { t.items[i], t.items[j] = t.items[j], t.items[i] }
+func (t *topCombinations[T]) Push(x any)         { t.items = append(t.items, x.(rankedCombination[T])) }
+func (t *topCombinations[T]) Pop() any {
+	last := t.items[len(t.items)-1]
+	t.items = t.items[:len(t.items)-1]
+	return last
+}
+
+func (t *topCombinations[T]) before(a, b rankedCombination[T]) bool {
+	if t.less(a.key, b.key) {
+		return true
+	}
+	if t.less(b.key, a.key) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+// offer keeps the combination ranked by key if it is among the best n so far. build is
+// only called then, so combinations that don't make it cost nothing.
+func (t *topCombinations[T]) offer(key comboKey, build func() T) {
+	r := rankedCombination[T]{key: key, seq: t.seq}
+	t.seq++
+	if len(t.items) == t.n && !t.before(r, t.items[0]) {
+		return
+	}
+	r.value = build()
+	if len(t.items) < t.n {
+		heap.Push(t, r)
+		return
+	}
+	t.items[0] = r
+	heap.Fix(t, 0)
+}
+
+// sorted returns the kept combinations best first.
+func (t *topCombinations[T]) sorted() []T {
+	if len(t.items) == 0 {
+		return nil
+	}
+	sort.Slice(t.items, func(i, j int) bool { return t.before(t.items[i], t.items[j]) })
+	out := make([]T, len(t.items))
+	for i, r := range t.items {
+		out[i] = r.value
+	}
+	return out
+}
+
+// comboLess orders combinations by the user's sort_by, falling back to the best-value
+// score for ties and when no (or an unknown) sort is requested.
+func comboLess(sortBy *string) func(a, b comboKey) bool {
+	bestValue := func(k comboKey) int {
+		return k.price + k.stops*100000 + k.minutes*100
+	}
+	byValue := func(a, b comboKey) bool { return bestValue(a) < bestValue(b) }
+	if sortBy == nil {
+		return byValue
+	}
+
+	var order func(a, b comboKey) int
+	switch *sortBy {
+	case "price_asc":
+		order = func(a, b comboKey) int { return cmp.Compare(a.price, b.price) }
+	case "price_desc":
+		order = func(a, b comboKey) int { return cmp.Compare(b.price, a.price) }
+	case "duration_asc":
+		order = func(a, b comboKey) int { return cmp.Compare(a.minutes, b.minutes) }
+	case "duration_desc":
+		order = func(a, b comboKey) int { return cmp.Compare(b.minutes, a.minutes) }
+	case "departure_asc":
+		order = func(a, b comboKey) int { return cmp.Compare(a.departure, b.departure) }
+	case "departure_desc":
+		order = func(a, b comboKey) int { return cmp.Compare(b.departure, a.departure) }
+	case "arrival_asc":
+		order = func(a, b comboKey) int { return cmp.Compare(a.arrival, b.arrival) }
+	case "arrival_desc":
+		order = func(a, b comboKey) int { return cmp.Compare(b.arrival, a.arrival) }
+	default:
+		return byValue
+	}
+	return func(a, b comboKey) bool {
+		if c := order(a, b); c != 0 {
+			return c < 0
+		}
+		return byValue(a, b)
+	}
+}
@@ -0,0 +1,101 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"flight-aggregator/models"
+	"flight-aggregator/providers"
+)
+
+// SearchStream runs a search and reports each provider as it answers, together with
+// every flight received so far run through the filter, dedupe and rank pipeline. The
+// channel ends with a done event carrying the metadata and, if the search failed or
+// timed out, the error along with whatever flights had arrived. It is buffered for
+// every event, so the caller may stop reading at any time. Invalid requests are
+// rejected before streaming starts.
+func (s *AggregatorService) SearchStream(ctx context.Context, req models.SearchRequest) (<-chan models.SearchEvent, error) {
+	start := time.Now()
+	if err := req.Validate(s.now()); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	provs := s.activeProviders()
+	events := make(chan models.SearchEvent, len(provs)+1)
+	if resp, found := s.cache.Get(cacheKey(req, providerNames(provs))); found {
+		resp.Metadata.SearchTimeMs = time.Since(start).Milliseconds()
+		resp.Metadata.CacheHit = true
+		events <- models.SearchEvent{Type: models.EventDone, Flights: resp.Flights, Metadata: &resp.Metadata}
+		close(events)
+		return events, nil
+	}
+
+	go s.stream(ctx, provs, req, start, events)
+	return events, nil
+}
+
+func (s *AggregatorService) stream(ctx context.Context, provs []providers.Provider, req models.SearchRequest, start time.Time, events chan<- models.SearchEvent) {
+	defer close(events)
+	ctx = s.withFetchSlots(ctx)
+
+	c := newCollector(provs)
+	var ranked []models.Flight
+	var err error
+	results := s.queryProviders(ctx, provs, req)
+
+wait:
+	for {
+		select {
+		case res, ok := <-results:
+			if !ok {
+				break wait
+			}
+			c.add(res)
+			if len(res.flights) > 0 {
+				// result hands out a fresh copy, so the pipeline can work on it in place
+				if ranked, err = s.pipeline(c.result().flights, req); err != nil {
+					break wait
+				}
+			}
+			st := res.status
+			events <- models.SearchEvent{Type: models.EventProvider, Provider: &st, Flights: ranked}
+		case <-ctx.Done():
+			err = ctx.Err()
+			break wait
+		}
+	}
+
+	fetched := c.result()
+	if err != nil {
+		markPending(fetched.statuses, err)
+	}
+	if err == nil && len(provs) > 0 && fetched.succeeded() == 0 {
+		err = ErrAllProvidersFailed
+	}
+	if err == nil && s.needsConnections(fetched.flights, req) {
+		// Stitch connections from the hub legs before the final ranking
+		n := len(fetched.flights)
+		if fetched = s.connectingLegs(ctx, fetched, req, start); len(fetched.flights) > n {
+			ranked, err = s.pipeline(fetched.flights, req)
+		}
+	}
+	meta := s.metadata(len(ranked), fetched, start)
+	if err == nil && fetched.complete() {
+		s.cache.Set(cacheKey(req, providerNames(provs)), models.SearchResponse{SearchCriteria: req, Metadata: meta, Flights: ranked})
+	}
+	events <- models.SearchEvent{Type: models.EventDone, Flights: ranked, Metadata: &meta, Err: err}
+}
+
+// markPending fills in the status of providers that had not answered when the search
+// stopped waiting for them.
+func markPending(statuses []models.ProviderStatus, err error) {
+	for i, st := range statuses {
+		if st.Status != "" {
+			continue
+		}
+		statuses[i].Status = models.ProviderFailed
+		statuses[i].ErrorCode = classifyError(err)
+		statuses[i].Error = err.Error()
+	}
+}
@@ -0,0 +1,93 @@
+// Package airports holds reference data for the airports and metropolitan
+// city codes the aggregator understands.
+package airports
+
+import "sort"
+
+// Airport describes a single airport.
+type Airport struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	City     string `json:"city"`
+	CityCode string `json:"city_code"` // metropolitan area code, equal to Code for single-airport cities
+	Timezone string `json:"timezone"`  // IANA zone name
+}
+
+var airports = map[string]Airport{
+	"CGK": {Code: "CGK", Name: "Soekarno-Hatta International", City: "Jakarta", CityCode: "JKT", Timezone: "Asia/Jakarta"},
+	"HLP": {Code: "HLP", Name: "Halim Perdanakusuma International", City: "Jakarta", CityCode: "JKT", Timezone: "Asia/Jakarta"},
+	"DPS": {Code: "DPS", Name: "Ngurah Rai International", City: "Denpasar", CityCode: "DPS", Timezone: "Asia/Makassar"},
+	"SUB": {Code: "SUB", Name: "Juanda International", City: "Surabaya", CityCode: "SUB", Timezone: "Asia/Jakarta"},
+	"UPG": {Code: "UPG", Name: "Sultan Hasanuddin International", City: "Makassar", CityCode: "UPG", Timezone: "Asia/Makassar"},
+	"SOC": {Code: "SOC", Name: "Adisumarmo International", City: "Surakarta", CityCode: "SOC", Timezone: "Asia/Jakarta"},
+	"YIA": {Code: "YIA", Name: "Yogyakarta International", City: "Yogyakarta", CityCode: "YIA", Timezone: "Asia/Jakarta"},
+	"SRG": {Code: "SRG", Name: "Jenderal Ahmad Yani International", City: "Semarang", CityCode: "SRG", Timezone: "Asia/Jakarta"},
+	"BDO": {Code: "BDO", Name: "Husein Sastranegara International", City: "Bandung", CityCode: "BDO", Timezone: "Asia/Jakarta"},
+	"KNO": {Code: "KNO", Name: "Kualanamu International", City: "Medan", CityCode: "MES", Timezone: "Asia/Jakarta"},
+	"BPN": {Code: "BPN", Name: "Sultan Aji Muhammad Sulaiman Sepinggan", City: "Balikpapan", CityCode: "BPN", Timezone: "Asia/Makassar"},
+	"LOP": {Code: "LOP", Name: "Zainuddin Abdul Madjid International", City: "Praya", CityCode: "LOP", Timezone: "Asia/Makassar"},
+	"PLM": {Code: "PLM", Name: "Sultan Mahmud Badaruddin II International", City: "Palembang", CityCode: "PLM", Timezone: "Asia/Jakarta"},
+	"BTH": {Code: "BTH", Name: "Hang Nadim International", City: "Batam", CityCode: "BTH", Timezone: "Asia/Jakarta"},
+}
+
+// hubs are the airports most domestic connections go through, busiest first.
+var hubs = []string{"CGK", "SUB", "UPG", "DPS", "KNO", "BPN"}
+
+// cities maps metropolitan city codes to their member airports, built from airports.
+var cities = buildCities()
+
+func buildCities() map[string][]string {
+	m := make(map[string][]string)
+	for code, a := range airports {
+		if a.CityCode != code {
+			m[a.CityCode] = append(m[a.CityCode], code)
+		}
+	}
+	for _, members := range m {
+		sort.Strings(members)
+	}
+	return m
+}
+
+// Lookup returns the airport with the given IATA code.
+func Lookup(code string) (Airport, bool) {
+	a, ok := airports[code]
+	return a, ok
+}
+
+// Hubs returns the airports most domestic connections go through, busiest first.
+func Hubs() []string {
+	return append([]string(nil), hubs...)
+}
+
+// IsCity reports whether code is a metropolitan city code rather than an airport.
+func IsCity(code string) bool {
+	_, ok := cities[code]
+	return ok
+}
+
+// Expand returns the member airports of a city code, or the code itself otherwise.
+func Expand(code string) []string {
+	if members, ok := cities[code]; ok {
+		return append([]string(nil), members...)
+	}
+	return []string{code}
+}
+
+// Matches reports whether airport is code itself or one of its member airports.
+func Matches(code, airport string) bool {
+	if code == airport {
+		return true
+	}
+	for _, m := range cities[code] {
+		if m == airport {
+			return true
+		}
+	}
+	return false
+}
+
+// CityName returns the city served by an airport, or "" when it's unknown.
+func CityName(code string) string {
+	return airports[code].City
+}
@@ -0,0 +1,40 @@
+package airports
+
+import "testing"
+
+func TestExpand(t *testing.T) {
+	got := Expand("JKT")
+	if len(got) != 2 || got[0] != "CGK" || got[1] != "HLP" {
+		t.Errorf("expected JKT to expand to CGK and HLP, got %v", got)
+	}
+	if got := Expand("DPS"); len(got) != 1 || got[0] != "DPS" {
+		t.Errorf("expected an airport code to expand to itself, got %v", got)
+	}
+	if !IsCity("JKT") || IsCity("CGK") {
+		t.Error("unexpected IsCity result")
+	}
+}
+
+func TestMatches(t *testing.T) {
+	cases := []struct {
+		code, airport string
+		want          bool
+	}{
+		{"JKT", "CGK", true},
+		{"JKT", "HLP", true},
+		{"JKT", "DPS", false},
+		{"CGK", "CGK", true},
+		{"CGK", "HLP", false},
+	}
+	for _, c := range cases {
+		if got := Matches(c.code, c.airport); got != c.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", c.code, c.airport, got, c.want)
+		}
+	}
+}
+
+func TestCityName(t *testing.T) {
+	if CityName("SOC") != "Surakarta" || CityName("XXX") != "" {
+		t.Errorf("unexpected city names: %q %q", CityName("SOC"), CityName("XXX"))
+	}
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"flight-aggregator/aggregator"
+	"flight-aggregator/models"
+	"flight-aggregator/providers"
+)
+
+type stubProvider struct {
+	name    string
+	flights []models.Flight
+	err     error
+	delay   time.Duration
+}
+
+func (p *stubProvider) Name() string { return p.name }
+func (p *stubProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return p.flights, p.err
+}
+
+func stubFlight(number string, price int) models.Flight {
+	dep := time.Date(2025, 12, 15, 6, 0, 0, 0, time.FixedZone("WIB", 7*3600))
+	arr := dep.Add(110 * time.Minute)
+	return models.Flight{
+		ID:           number + "_Stub",
+		Provider:     "Stub",
+		Airline:      models.Airline{Name: "Stub Air", Code: "SA"},
+		FlightNumber: number,
+		Departure:    models.Event{Airport: "CGK", Datetime: dep.Format(time.RFC3339), Timestamp: dep.Unix()},
+		Arrival:      models.Event{Airport: "DPS", Datetime: arr.Format(time.RFC3339), Timestamp: arr.Unix()},
+		Duration:     models.Duration{TotalMinutes: 110, Formatted: "1h 50m"},
+		Price:        models.Price{Amount: price, Currency: "IDR"},
+	}
+}
+
+func newTestServer(timeout time.Duration, provs ...providers.Provider) *Server {
+	clock := aggregator.WithClock(func() time.Time { return time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC) })
+	return NewServer(aggregator.NewAggregatorService(provs, clock), timeout)
+}
+
+func TestServer_SearchPost(t *testing.T) {
+	srv := newTestServer(time.Second, &stubProvider{name: "Stub", flights: []models.Flight{stubFlight("SA1", 900000)}})
+	body := `{"origin":"CGK","destination":"DPS","departure_date":"2025-12-15","passengers":"1","cabinClass":"economy"}`
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/flights/search", strings.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp models.SearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Metadata.TotalResults != 1 || resp.Flights[0].FlightNumber != "SA1" {
+		t.Errorf("unexpected flights: %+v", resp.Flights)
+	}
+}
+
+func TestServer_SearchGet(t *testing.T) {
+	srv := newTestServer(time.Second, &stubProvider{name: "Stub", flights: []models.Flight{stubFlight("SA1", 900000), stubFlight("SA2", 400000)}})
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/flights/search?origin=CGK&destination=DPS&departure_date=2025-12-15&passengers=1&max_price=500000", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp models.SearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(resp.Flights) != 1 || resp.Flights[0].FlightNumber != "SA2" {
+		t.Errorf("expected only SA2 after max_price filter, got %+v", resp.Flights)
+	}
+}
+
+func TestServer_SearchErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		srv    *Server
+		target string
+		status int
+	}{
+		{
+			name:   "missing origin",
+			srv:    newTestServer(time.Second, &stubProvider{name: "Stub"}),
+			target: "/v1/flights/search?destination=DPS&departure_date=2025-12-17",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "non numeric filter",
+			srv:    newTestServer(time.Second, &stubProvider{name: "Stub"}),
+			target: "/v1/flights/search?origin=CGK&destination=DPS&departure_date=2025-12-17&max_price=cheap",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "timeout",
+			srv:    newTestServer(20*time.Millisecond, &stubProvider{name: "Slow", delay: time.Second}),
+			target: "/v1/flights/search?origin=CGK&destination=DPS&departure_date=2025-12-18",
+			status: http.StatusGatewayTimeout,
+		},
+		{
+			name:   "all providers failed",
+			srv:    newTestServer(5*time.Second, &stubProvider{name: "Down", err: errors.New("boom")}),
+			target: "/v1/flights/search?origin=CGK&destination=DPS&departure_date=2025-12-19",
+			status: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			var body errorBody
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Error.Code == "" {
+				t.Errorf("expected error body, got %q (%v)", rec.Body.String(), err)
+			}
+		})
+	}
+}
+
+func TestServer_SearchValidationFields(t *testing.T) {
+	srv := newTestServer(time.Second, &stubProvider{name: "Stub"})
+	body := `{"origin":"cgk","destination":"DPS","departure_date":"15-12-2025","passengers":"0"}`
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/flights/search", strings.NewReader(body)))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp errorBody
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	codes := make(map[string]string)
+	for _, f := range resp.Error.Fields {
+		codes[f.Field] = f.Code
+	}
+	if codes["origin"] != models.CodeInvalidFormat || codes["departure_date"] != models.CodeInvalidFormat || codes["passengers"] != models.CodeOutOfRange {
+		t.Errorf("unexpected field errors: %+v", resp.Error.Fields)
+	}
+}
+
+func TestServer_ProviderHealth(t *testing.T) {
+	srv := newTestServer(time.Second, &stubProvider{name: "Stub"}, &stubProvider{name: "Other"})
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/health/providers", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Status    string                  `json:"status"`
+		Providers []models.ProviderHealth `json:"providers"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != "ok" || len(body.Providers) != 2 || body.Providers[0].State != aggregator.BreakerClosed {
+		t.Errorf("unexpected health body: %+v", body)
+	}
+}
+
+func TestServer_SearchStream(t *testing.T) {
+	srv := newTestServer(time.Second,
+		&stubProvider{name: "Fast", flights: []models.Flight{stubFlight("SA1", 900000)}},
+		&stubProvider{name: "Slow", delay: 30 * time.Millisecond, flights: []models.Flight{stubFlight("SA2", 800000)}},
+	)
+	target := "/v1/flights/search/stream?origin=CGK&destination=DPS&departure_date=2025-12-15&passengers=2"
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target+"&format=ndjson", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("expected an NDJSON stream, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 events, got %d: %s", len(lines), rec.Body.String())
+	}
+	var done streamEvent
+	if err := json.Unmarshal([]byte(lines[2]), &done); err != nil {
+		t.Fatal(err)
+	}
+	if done.Type != models.EventDone || done.Metadata == nil || len(done.Flights) != 2 || done.Error != nil {
+		t.Errorf("unexpected done event: %s", lines[2])
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, strings.Replace(target, "passengers=2", "passengers=3", 1), nil))
+	if rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected SSE by default, got %q", rec.Header().Get("Content-Type"))
+	}
+	if body := rec.Body.String(); strings.Count(body, "event: provider\ndata: ") != 2 || !strings.Contains(body, "event: done\ndata: ") {
+		t.Errorf("unexpected SSE body: %s", body)
+	}
+}
+
+func TestServer_SearchStream_AllProvidersFailed(t *testing.T) {
+	srv := newTestServer(time.Second, &stubProvider{name: "Down", err: providers.Errorf(providers.KindAuth, "bad key")})
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/flights/search/stream?origin=CGK&destination=DPS&departure_date=2025-12-16&format=ndjson", nil))
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	var done streamEvent
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &done); err != nil {
+		t.Fatal(err)
+	}
+	if done.Error == nil || done.Error.Code != "providers_unavailable" {
+		t.Errorf("expected providers_unavailable on the done event, got %s", lines[len(lines)-1])
+	}
+}
+
+func TestServer_AdminProviders(t *testing.T) {
+	clock := aggregator.WithClock(func() time.Time { return time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC) })
+	agg := aggregator.NewAggregatorService([]providers.Provider{&stubProvider{name: "Stub"}}, clock)
+	srv := NewServer(agg, time.Second, WithAdminToken("s3cret"))
+
+	patch := func(path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := patch("/v1/admin/providers/Stub", "wrong", `{"enabled":false}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the token, got %d", rec.Code)
+	}
+	if rec := patch("/v1/admin/providers/Nope", "s3cret", `{"enabled":false}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown provider, got %d", rec.Code)
+	}
+	if rec := patch("/v1/admin/providers/Stub", "s3cret", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without enabled, got %d", rec.Code)
+	}
+
+	rec := patch("/v1/admin/providers/Stub", "s3cret", `{"enabled":false}`)
+	var h models.ProviderHealth
+	if err := json.NewDecoder(rec.Body).Decode(&h); err != nil || rec.Code != http.StatusOK || h.Enabled {
+		t.Fatalf("expected the provider disabled, got %d %+v (%v)", rec.Code, h, err)
+	}
+	if health := agg.ProviderHealth(); health[0].Enabled {
+		t.Error("provider still enabled after PATCH")
+	}
+
+	rec = httptest.NewRecorder()
+	newTestServer(time.Second, &stubProvider{name: "Stub"}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/admin/providers", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("admin endpoints should not exist without a token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,422 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"flight-aggregator/aggregator"
+	"flight-aggregator/models"
+)
+
+// Server exposes the aggregator search over HTTP.
+type Server struct {
+	agg        *aggregator.AggregatorService
+	timeout    time.Duration
+	adminToken string
+	mux        *http.ServeMux
+}
+
+// ServerOption customizes a Server.
+type ServerOption func(*Server)
+
+// WithAdminToken enables the /v1/admin endpoints for requests carrying
+// "Authorization: Bearer <token>". Without it the admin endpoints don't exist.
+func WithAdminToken(token string) ServerOption {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// NewServer wires the HTTP routes. Every search is bounded by timeout.
+func NewServer(agg *aggregator.AggregatorService, timeout time.Duration, opts ...ServerOption) *Server {
+	s := &Server{agg: agg, timeout: timeout, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.mux.HandleFunc("POST /v1/flights/search", s.handleSearch)
+	s.mux.HandleFunc("GET /v1/flights/search", s.handleSearch)
+	s.mux.HandleFunc("POST /v1/flights/search/round-trip", s.handleRoundTrip)
+	s.mux.HandleFunc("GET /v1/flights/search/round-trip", s.handleRoundTrip)
+	s.mux.HandleFunc("POST /v1/flights/search/multi-city", s.handleMultiCity)
+	s.mux.HandleFunc("POST /v1/flights/search/flexible", s.handleFlexible)
+	s.mux.HandleFunc("GET /v1/flights/search/flexible", s.handleFlexible)
+	s.mux.HandleFunc("POST /v1/flights/search/stream", s.handleStream)
+	s.mux.HandleFunc("GET /v1/flights/search/stream", s.handleStream)
+	s.mux.HandleFunc("GET /v1/health/providers", s.handleProviderHealth)
+	if s.adminToken != "" {
+		s.mux.HandleFunc("GET /v1/admin/providers", s.requireAdmin(s.handleListProviders))
+		s.mux.HandleFunc("PATCH /v1/admin/providers/{name}", s.requireAdmin(s.handleUpdateProvider))
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Fields  []models.FieldError `json:"fields,omitempty"`
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeSearchRequest(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	resp, err := s.agg.Search(ctx, req)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleRoundTrip(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeSearchRequest(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	resp, err := s.agg.SearchRoundTrip(ctx, req)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleFlexible(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeSearchRequest(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	resp, err := s.agg.SearchFlexible(ctx, req)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleMultiCity(w http.ResponseWriter, r *http.Request) {
+	var req models.MultiCityRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	resp, err := s.agg.SearchMultiCity(ctx, req)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// streamEvent is the wire format of a models.SearchEvent.
+type streamEvent struct {
+	models.SearchEvent
+	Error *errorDetail `json:"error,omitempty"`
+}
+
+// handleStream streams a search as Server-Sent Events, or as newline-delimited JSON when
+// the client asks for application/x-ndjson or passes format=ndjson.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeSearchRequest(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	events, err := s.agg.SearchStream(ctx, req)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+
+	ndjson := r.URL.Query().Get("format") == "ndjson" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	for ev := range events {
+		if errors.Is(ev.Err, context.Canceled) {
+			// Client went away, nobody is left to read the rest
+			return
+		}
+		out := streamEvent{SearchEvent: ev}
+		if ev.Err != nil {
+			_, detail := searchErrorDetail(ev.Err)
+			out.Error = &detail
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			log.Printf("encoding stream event: %v", err)
+			return
+		}
+		if ndjson {
+			_, err = fmt.Fprintf(w, "%s\n", data)
+		} else {
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+		if err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// handleProviderHealth reports every provider's circuit breaker. The status is 503
+// when no enabled provider is currently accepting requests.
+func (s *Server) handleProviderHealth(w http.ResponseWriter, r *http.Request) {
+	health := s.agg.ProviderHealth()
+	status, overall := http.StatusOK, "ok"
+	enabled, open := 0, 0
+	for _, h := range health {
+		if !h.Enabled {
+			continue
+		}
+		enabled++
+		if h.State != aggregator.BreakerClosed {
+			overall = "degraded"
+		}
+		if h.State == aggregator.BreakerOpen {
+			open++
+		}
+	}
+	if len(health) > 0 && open == enabled {
+		status, overall = http.StatusServiceUnavailable, "unavailable"
+	}
+	writeJSON(w, status, struct {
+		Status    string                  `json:"status"`
+		Providers []models.ProviderHealth `json:"providers"`
+	}{overall, health})
+}
+
+// requireAdmin rejects requests without the admin bearer token.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	want := []byte("Bearer " + s.adminToken)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleListProviders(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Providers []models.ProviderHealth `json:"providers"`
+	}{s.agg.ProviderHealth()})
+}
+
+// handleUpdateProvider switches a provider on or off with {"enabled": bool}.
+func (s *Server) handleUpdateProvider(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	if body.Enabled == nil {
+		verr := &models.ValidationError{}
+		verr.Add("enabled", models.CodeRequired, "is required")
+		writeValidationError(w, verr)
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := s.agg.SetProviderEnabled(name, *body.Enabled); err != nil {
+		if errors.Is(err, aggregator.ErrUnknownProvider) {
+			writeError(w, http.StatusNotFound, "not_found", fmt.Sprintf("no provider named %q", name))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	for _, h := range s.agg.ProviderHealth() {
+		if h.Name == name {
+			writeJSON(w, http.StatusOK, h)
+			return
+		}
+	}
+}
+
+// decodeSearchRequest reads a SearchRequest from the JSON body of a POST or the
+// query string of a GET. On failure the error response is already written.
+func decodeSearchRequest(w http.ResponseWriter, r *http.Request) (models.SearchRequest, bool) {
+	if r.Method == http.MethodGet {
+		req, verr := parseSearchQuery(r.URL.Query())
+		if verr != nil {
+			writeValidationError(w, verr)
+			return models.SearchRequest{}, false
+		}
+		return req, true
+	}
+
+	var req models.SearchRequest
+	if !decodeJSONBody(w, r, &req) {
+		return models.SearchRequest{}, false
+	}
+	return req, true
+}
+
+// decodeJSONBody decodes a request body, reporting type mismatches as field errors.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, target interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err := dec.Decode(target); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			verr := &models.ValidationError{}
+			verr.Add(typeErr.Field, models.CodeInvalidFormat, "must be a JSON %s", typeErr.Type.Kind())
+			writeValidationError(w, verr)
+			return false
+		}
+		writeError(w, http.StatusBadRequest, "invalid_body", fmt.Sprintf("invalid JSON body: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeSearchError maps aggregator errors to HTTP status codes.
+func writeSearchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.Canceled) {
+		// Client went away, nobody is left to read the response
+		return
+	}
+	status, detail := searchErrorDetail(err)
+	writeJSON(w, status, errorBody{Error: detail})
+}
+
+// searchErrorDetail picks the status code and error body for an aggregator error.
+func searchErrorDetail(err error) (int, errorDetail) {
+	var verr *models.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return http.StatusBadRequest, validationDetail(verr)
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, errorDetail{Code: "timeout", Message: "search timed out before providers responded"}
+	case errors.Is(err, aggregator.ErrAllProvidersFailed):
+		return http.StatusBadGateway, errorDetail{Code: "providers_unavailable", Message: err.Error()}
+	default:
+		return http.StatusInternalServerError, errorDetail{Code: "internal_error", Message: err.Error()}
+	}
+}
+
+func writeValidationError(w http.ResponseWriter, verr *models.ValidationError) {
+	writeJSON(w, http.StatusBadRequest, errorBody{Error: validationDetail(verr)})
+}
+
+func validationDetail(verr *models.ValidationError) errorDetail {
+	return errorDetail{Code: "invalid_request", Message: verr.Error(), Fields: verr.Fields}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, errorBody{Error: errorDetail{Code: code, Message: message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("writing response: %v", err)
+	}
+}
+
+// parseSearchQuery builds a SearchRequest from query parameters named after the JSON fields.
+// Every malformed parameter is reported, not just the first.
+func parseSearchQuery(q url.Values) (models.SearchRequest, *models.ValidationError) {
+	req := models.SearchRequest{
+		Origin:        q.Get("origin"),
+		Destination:   q.Get("destination"),
+		DepartureDate: q.Get("departure_date"),
+		Passengers:    q.Get("passengers"),
+		CabinClass:    q.Get("cabinClass"),
+		ReturnDate:    optionalString(q, "returnDate"),
+		SortBy:        optionalString(q, "sort_by"),
+
+		DepartureTimeStart: optionalString(q, "departure_time_start"),
+		DepartureTimeEnd:   optionalString(q, "departure_time_end"),
+		ArrivalTimeStart:   optionalString(q, "arrival_time_start"),
+		ArrivalTimeEnd:     optionalString(q, "arrival_time_end"),
+	}
+
+	ints := []struct {
+		name   string
+		target **int
+	}{
+		{"min_price", &req.MinPrice},
+		{"max_price", &req.MaxPrice},
+		{"min_stops", &req.MinStops},
+		{"max_stops", &req.MaxStops},
+		{"min_duration_minutes", &req.MinDurationMinutes},
+		{"max_duration_minutes", &req.MaxDurationMinutes},
+		{"flex_days", &req.FlexDays},
+	}
+	verr := &models.ValidationError{}
+	for _, p := range ints {
+		if !q.Has(p.name) {
+			continue
+		}
+		v, err := strconv.Atoi(q.Get(p.name))
+		if err != nil {
+			verr.Add(p.name, models.CodeInvalidFormat, "must be an integer")
+			continue
+		}
+		*p.target = &v
+	}
+	if len(verr.Fields) > 0 {
+		return models.SearchRequest{}, verr
+	}
+
+	// Airlines may be repeated or comma separated
+	for _, v := range q["airlines"] {
+		for _, a := range strings.Split(v, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				req.Airlines = append(req.Airlines, a)
+			}
+		}
+	}
+	return req, nil
+}
+
+func optionalString(q url.Values, name string) *string {
+	if !q.Has(name) {
+		return nil
+	}
+	v := q.Get(name)
+	return &v
+}
@@ -0,0 +1,61 @@
+// Command provider-simulator serves the sample airline payloads over HTTP with
+// scenario-driven faults, for running the aggregator end to end against its HTTP
+// adapters (see providers.simulator.json).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"flight-aggregator/simulator"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "HTTP listen address")
+	dataDir := flag.String("data", "mock_data", "directory holding the sample payloads")
+	scenarioName := flag.String("scenario", "default", "bundled scenario name or JSON scenario file")
+	seed := flag.Int64("seed", 0, "random seed for reproducible faults, 0 picks one")
+	flag.Parse()
+
+	sc, err := simulator.LoadScenario(*scenarioName)
+	if err != nil {
+		log.Fatalf("Loading scenario: %v", err)
+	}
+	var opts []simulator.Option
+	if *seed != 0 {
+		opts = append(opts, simulator.WithSeed(*seed))
+	}
+	sim, err := simulator.NewServer(*dataDir, sc, opts...)
+	if err != nil {
+		log.Fatalf("Loading sample data: %v", err)
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: sim, ReadHeaderTimeout: 5 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Provider simulator listening on %s with scenario %q", *addr, sc.Name)
+		for _, a := range simulator.Airlines {
+			log.Printf("  %-10s %s %s%s", a.Key, a.Method, a.Prefix(), a.Path)
+		}
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	// Timeout faults hold requests open until the client gives up, don't wait for them
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	log.Println("Simulator stopped")
+}
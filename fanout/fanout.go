@@ -0,0 +1,86 @@
+// Package fanout runs independent tasks concurrently with a bound on how many run at
+// once, recovering panics so a misbehaving task is reported instead of crashing the
+// process.
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of one task.
+type Result[T any] struct {
+	Index   int // position of the task, 0 to n-1
+	Value   T
+	Err     error
+	Elapsed time.Duration // time spent running the task, zero if it never started
+}
+
+// PanicError reports a task that panicked.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("panic: %v", e.Value) }
+
+// Run starts task for every index from 0 to n-1 with at most limit running at once
+// (no limit when limit <= 0) and delivers each result as soon as it is ready. Tasks
+// still waiting for a slot when ctx is done are not started and report ctx.Err().
+// The channel is buffered for every result, so nothing blocks if the caller stops
+// reading, and it is closed once every task has finished.
+func Run[T any](ctx context.Context, n, limit int, task func(ctx context.Context, i int) (T, error)) <-chan Result[T] {
+	results := make(chan Result[T], n)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	slots := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				results <- Result[T]{Index: i, Err: ctx.Err()}
+				return
+			}
+			results <- run(ctx, i, task)
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+func run[T any](ctx context.Context, i int, task func(ctx context.Context, i int) (T, error)) (res Result[T]) {
+	res.Index = i
+	start := time.Now()
+	defer func() {
+		res.Elapsed = time.Since(start)
+		if r := recover(); r != nil {
+			res.Err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	res.Value, res.Err = task(ctx, i)
+	return res
+}
+
+// Collect waits for every result and returns them in task order.
+func Collect[T any](results <-chan Result[T]) []Result[T] {
+	var all []Result[T]
+	for r := range results {
+		all = append(all, r)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Index < all[j].Index })
+	return all
+}
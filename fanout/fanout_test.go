@@ -0,0 +1,94 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun_BoundsConcurrency(t *testing.T) {
+	var running, peak int32
+	results := Collect(Run(context.Background(), 20, 3, func(ctx context.Context, i int) (int, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return i * i, nil
+	}))
+
+	if peak > 3 {
+		t.Errorf("expected at most 3 tasks at once, saw %d", peak)
+	}
+	if len(results) != 20 {
+		t.Fatalf("expected 20 results, got %d", len(results))
+	}
+	for i, r := range results {
+		if r.Index != i || r.Value != i*i || r.Err != nil || r.Elapsed <= 0 {
+			t.Errorf("unexpected result %d: %+v", i, r)
+		}
+	}
+}
+
+func TestRun_RecoversPanics(t *testing.T) {
+	results := Collect(Run(context.Background(), 3, 0, func(ctx context.Context, i int) (string, error) {
+		switch i {
+		case 1:
+			panic("provider exploded")
+		case 2:
+			return "", errors.New("boom")
+		}
+		return "ok", nil
+	}))
+
+	if results[0].Value != "ok" || results[0].Err != nil {
+		t.Errorf("healthy task affected by the panic: %+v", results[0])
+	}
+	var panicErr *PanicError
+	if !errors.As(results[1].Err, &panicErr) || panicErr.Value != "provider exploded" || len(panicErr.Stack) == 0 {
+		t.Errorf("expected a recovered panic, got %v", results[1].Err)
+	}
+	if results[2].Err == nil || errors.As(results[2].Err, &panicErr) {
+		t.Errorf("expected the task's own error, got %v", results[2].Err)
+	}
+}
+
+func TestRun_CancelledBeforeStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	var started int32
+	results := Run(ctx, 5, 1, func(ctx context.Context, i int) (int, error) {
+		atomic.AddInt32(&started, 1)
+		<-release
+		return i, nil
+	})
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	var cancelled int
+	for r := range results {
+		if errors.Is(r.Err, context.Canceled) {
+			cancelled++
+		}
+	}
+	if started != 1 || cancelled != 4 {
+		t.Errorf("expected 1 started and 4 cancelled tasks, got %d started and %d cancelled", started, cancelled)
+	}
+}
+
+func TestRun_NoTasks(t *testing.T) {
+	if results := Collect(Run(context.Background(), 0, 4, func(ctx context.Context, i int) (int, error) {
+		return 0, nil
+	})); len(results) != 0 {
+		t.Errorf("expected no results, got %v", results)
+	}
+}
@@ -2,85 +2,89 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"flight-aggregator/aggregator"
-	"flight-aggregator/models"
+	"flight-aggregator/api"
 	"flight-aggregator/providers"
 )
 
 func main() {
-	// Initialize simulated providers
-	provs := []providers.Provider{
-		&providers.GarudaProvider{},
-		&providers.AirAsiaProvider{},
-		&providers.LionAirProvider{},
-		&providers.BatikAirProvider{},
-	}
-
-	aggService := aggregator.NewAggregatorService(provs)
-
-	// Initialize all required and optional search variables
-	origin := "CGK"
-	destination := "DPS"
-	departureDate := "2025-12-15"
-	passengers := "1"
-	cabinClass := "economy"
-
-	// Optional filters
-	minPrice := 500000
-	maxPrice := 1500000
-	minStops := 0
-	maxStops := 1
-	departureTimeStart := "05:00"
-	departureTimeEnd := "20:00"
-	arrivalTimeStart := "07:00"
-	arrivalTimeEnd := "23:00"
-	airlines := []string{"Garuda Indonesia", "AirAsia", "Lion Air", "Batik Air"}
-	minDuration := 60
-	maxDuration := 300
+	addr := flag.String("addr", ":8080", "HTTP listen address")
+	searchTimeout := flag.Duration("search-timeout", 2*time.Second, "maximum time a single search may take")
+	softDeadline := flag.Duration("soft-deadline", 0, "return the results received so far after this long, 0 waits for every provider")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "time allowed for in-flight requests on shutdown")
+	providersConfig := flag.String("providers-config", "", "JSON provider configuration, defaults to every bundled provider")
+	cacheTTL := flag.Duration("cache-ttl", aggregator.DefaultCacheOptions().TTL, "how long search results are cached")
+	cacheSize := flag.Int("cache-size", aggregator.DefaultCacheOptions().MaxSize, "maximum number of cached searches")
+	providerCacheTTL := flag.Duration("provider-cache-ttl", aggregator.DefaultProviderCacheOptions().TTL, "how long each provider's flights for a route are reused, 0 disables")
+	cacheMaxBytes := flag.Int64("cache-max-bytes", 0, "maximum encoded size of cached searches, 0 for no limit")
+	adminToken := flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "bearer token for the /v1/admin endpoints, empty disables them")
+	flag.Parse()
 
-	// Build request
-	req := models.SearchRequest{
-		Origin:             origin,
-		Destination:        destination,
-		DepartureDate:      departureDate,
-		Passengers:         passengers,
-		CabinClass:         cabinClass,
-		MinPrice:           &minPrice,
-		MaxPrice:           &maxPrice,
-		MinStops:           &minStops,
-		MaxStops:           &maxStops,
-		DepartureTimeStart: &departureTimeStart,
-		DepartureTimeEnd:   &departureTimeEnd,
-		ArrivalTimeStart:   &arrivalTimeStart,
-		ArrivalTimeEnd:     &arrivalTimeEnd,
-		Airlines:           airlines,
-		MinDurationMinutes: &minDuration,
-		MaxDurationMinutes: &maxDuration,
+	cfgs := providers.DefaultConfig()
+	if *providersConfig != "" {
+		var err error
+		if cfgs, err = providers.LoadConfig(*providersConfig); err != nil {
+			log.Fatalf("Loading provider config: %v", err)
+		}
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	
-	response, err := aggService.Search(ctx, req)
+	cfgs, err := providers.ApplyEnv(cfgs, os.LookupEnv)
+	if err != nil {
+		log.Fatalf("Provider environment: %v", err)
+	}
+	provs, disabled, err := providers.BuiltinRegistry().Build(cfgs)
 	if err != nil {
-		log.Fatalf("Calling Aggregate Search got Error : %v", err)
+		log.Fatalf("Building providers: %v", err)
 	}
 
-	// Print results
-	b, _ := json.MarshalIndent(response, "", "  ")
-	log.Println(string(b))
+	cacheOpts := aggregator.DefaultCacheOptions()
+	cacheOpts.TTL, cacheOpts.MaxSize, cacheOpts.MaxBytes = *cacheTTL, *cacheSize, *cacheMaxBytes
+	cache := aggregator.NewMemoryCache(cacheOpts)
+	defer cache.Close()
+	providerCache := aggregator.DefaultProviderCacheOptions()
+	providerCache.TTL, providerCache.ProviderTTL = *providerCacheTTL, providers.CacheTTLs(provs)
+	opts := []aggregator.Option{
+		aggregator.WithDisabledProviders(disabled...),
+		aggregator.WithCache(cache),
+		aggregator.WithProviderCache(providerCache),
+	}
+	if *softDeadline > 0 {
+		opts = append(opts, aggregator.WithSoftDeadline(aggregator.SoftDeadline{Budget: *softDeadline, WarmCache: true}))
+	}
+	aggService := aggregator.NewAggregatorService(provs, opts...)
 
-	log.Println("Performing second search with same parameters to test caching...")
-	response2, err := aggService.Search(ctx, req)
-	if err != nil {
-		log.Fatalf("Calling Aggregate Search got Error : %v", err)
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           api.NewServer(aggService, *searchTimeout, api.WithAdminToken(*adminToken)),
+		ReadHeaderTimeout: 5 * time.Second,
 	}
 
-	// Print results
-	b2, _ := json.MarshalIndent(response2, "", "  ")
-	log.Println(string(b2))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Flight aggregator listening on %s", *addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down, draining in-flight requests...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Fatalf("Graceful shutdown failed: %v", err)
+	}
+	s := cache.Stats()
+	log.Printf("Server stopped, cache served %d hits and %d misses", s.Hits, s.Misses)
 }
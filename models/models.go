@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // SearchRequest represents the incoming search parameters[cite: 30].
 type SearchRequest struct {
 	Origin        string  `json:"origin"`
@@ -22,6 +24,9 @@ type SearchRequest struct {
 	MinDurationMinutes  *int     `json:"min_duration_minutes,omitempty"`
 	MaxDurationMinutes  *int     `json:"max_duration_minutes,omitempty"`
 	SortBy              *string  `json:"sort_by,omitempty"`
+
+	// FlexDays widens a flexible-date search to DepartureDate ± FlexDays.
+	FlexDays *int `json:"flex_days,omitempty"`
 }
 
 // SearchResponse matches the expected_result.json structure[cite: 50].
@@ -31,13 +36,176 @@ type SearchResponse struct {
 	Flights        []Flight      `json:"flights"`
 }
 
+// Streaming search event types.
+const (
+	EventProvider = "provider"
+	EventDone     = "done"
+)
+
+// SearchEvent is one update of a streaming search. A provider event follows every
+// provider's answer and the stream ends with a single done event.
+type SearchEvent struct {
+	Type     string          `json:"type"`
+	Provider *ProviderStatus `json:"provider,omitempty"` // the provider that just answered
+	Flights  []Flight        `json:"flights"`            // every flight so far, deduplicated and ranked
+	Metadata *Metadata       `json:"metadata,omitempty"` // only on the done event
+	Err      error           `json:"-"`                  // why the search failed, only on the done event
+}
+
+// FlexibleSearchResponse holds a fare calendar around the requested date plus the
+// regular results for the requested date itself.
+type FlexibleSearchResponse struct {
+	SearchCriteria SearchRequest     `json:"search_criteria"`
+	Metadata       Metadata          `json:"metadata"`
+	Calendar       []FareCalendarDay `json:"calendar"`
+	Flights        []Flight          `json:"flights"`
+}
+
+// Fare calendar day outcomes reported in FareCalendarDay.Status.
+const (
+	DayOK     = "ok"
+	DayFailed = "failed" // the day couldn't be searched, so no flights says nothing
+)
+
+// FareCalendarDay summarises the cheapest matching flight of one day.
+type FareCalendarDay struct {
+	Date            string `json:"date"`
+	Status          string `json:"status"`
+	CheapestPrice   *Price `json:"cheapest_price"` // nil when nothing matched
+	CheapestAirline string `json:"cheapest_airline,omitempty"`
+	FlightCount     int    `json:"flight_count"`
+	Selected        bool   `json:"selected"` // the requested DepartureDate
+	ErrorCode       string `json:"error_code,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// RoundTripResponse keeps both legs alongside the priced combinations.
+type RoundTripResponse struct {
+	SearchCriteria SearchRequest     `json:"search_criteria"`
+	Metadata       Metadata          `json:"metadata"`
+	Outbound       []Flight          `json:"outbound_flights"`
+	Inbound        []Flight          `json:"inbound_flights"`
+	Options        []RoundTripOption `json:"options"`
+}
+
+// RoundTripOption is an outbound and inbound flight priced together.
+type RoundTripOption struct {
+	ID            string   `json:"id"`
+	Outbound      Flight   `json:"outbound"`
+	Inbound       Flight   `json:"inbound"`
+	TotalPrice    Price    `json:"total_price"`
+	TotalDuration Duration `json:"total_duration"` // sum of both legs, excluding the stay
+	SameCarrier   bool     `json:"same_carrier"`
+}
+
+// Leg is one hop of a multi-city trip.
+type Leg struct {
+	Origin        string `json:"origin"`
+	Destination   string `json:"destination"`
+	DepartureDate string `json:"departure_date"` // format: YYYY-MM-DD
+}
+
+// MultiCityRequest searches an ordered list of legs booked as one trip.
+// Price filters apply to the whole itinerary, the other filters to each leg.
+type MultiCityRequest struct {
+	Legs                 []Leg    `json:"legs"`
+	Passengers           string   `json:"passengers"`
+	CabinClass           string   `json:"cabinClass"`
+	MinConnectionMinutes *int     `json:"min_connection_minutes,omitempty"` // between landing and the next leg
+	MinPrice             *int     `json:"min_price,omitempty"`
+	MaxPrice             *int     `json:"max_price,omitempty"`
+	MaxStops             *int     `json:"max_stops,omitempty"`
+	Airlines             []string `json:"airlines,omitempty"`
+	SortBy               *string  `json:"sort_by,omitempty"`
+}
+
+// LegRequest builds the one-way search for leg i, carrying over the per-leg filters.
+func (r MultiCityRequest) LegRequest(i int) SearchRequest {
+	leg := r.Legs[i]
+	return SearchRequest{
+		Origin:        leg.Origin,
+		Destination:   leg.Destination,
+		DepartureDate: leg.DepartureDate,
+		Passengers:    r.Passengers,
+		CabinClass:    r.CabinClass,
+		MaxStops:      r.MaxStops,
+		Airlines:      r.Airlines,
+	}
+}
+
+// MultiCityResponse lists complete itineraries covering every requested leg.
+type MultiCityResponse struct {
+	SearchCriteria MultiCityRequest `json:"search_criteria"`
+	Metadata       Metadata         `json:"metadata"`
+	Itineraries    []Itinerary      `json:"itineraries"`
+}
+
+// Itinerary is one flight per leg, in leg order, priced together.
+type Itinerary struct {
+	ID            string   `json:"id"`
+	Flights       []Flight `json:"flights"`
+	TotalPrice    Price    `json:"total_price"`
+	TotalDuration Duration `json:"total_duration"` // sum of the legs, excluding time between them
+}
+
 type Metadata struct {
-	TotalResults       int   `json:"total_results"`
-	ProvidersQueried   int   `json:"providers_queried"`
-	ProvidersSucceeded int   `json:"providers_succeeded"`
-	ProvidersFailed    int   `json:"providers_failed"`
-	SearchTimeMs       int64 `json:"search_time_ms"`
-	CacheHit           bool  `json:"cache_hit"`
+	TotalResults       int      `json:"total_results"`
+	ProvidersQueried   int      `json:"providers_queried"`
+	ProvidersSucceeded int      `json:"providers_succeeded"`
+	ProvidersFailed    int      `json:"providers_failed"`
+	ProvidersSkipped   []string `json:"providers_skipped,omitempty"`
+	Partial            bool     `json:"partial,omitempty"` // cut short by the soft deadline
+	SearchTimeMs       int64    `json:"search_time_ms"`
+	CacheHit           bool     `json:"cache_hit"`
+
+	Providers []ProviderStatus `json:"providers,omitempty"`
+}
+
+// Provider outcomes reported in ProviderStatus.Status.
+const (
+	ProviderOK      = "ok"
+	ProviderFailed  = "failed"
+	ProviderSkipped = "skipped"
+)
+
+// Classified provider failures reported in ProviderStatus.ErrorCode.
+const (
+	ErrorCodeTimeout           = "timeout"
+	ErrorCodeCanceled          = "canceled"
+	ErrorCodeUnavailable       = "unavailable"
+	ErrorCodeRateLimited       = "rate_limited"
+	ErrorCodeBadRequest        = "bad_request"
+	ErrorCodeNoAvailability    = "no_availability"
+	ErrorCodeAuthFailed        = "auth_failed"
+	ErrorCodeMalformedResponse = "malformed_response"
+	ErrorCodeCircuitOpen       = "circuit_open"
+	ErrorCodeProviderError     = "provider_error"
+)
+
+// ProviderStatus describes how one provider fared during a search.
+type ProviderStatus struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	HubAttempts int    `json:"hub_attempts,omitempty"` // calls for hub legs when the route had no direct flights
+	LatencyMs   int64  `json:"latency_ms"`
+	FlightCount int    `json:"flight_count"`
+	Cached      bool   `json:"cached,omitempty"` // answered from the provider cache without a call
+	ErrorCode   string `json:"error_code,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ProviderHealth is the circuit breaker state of one provider.
+type ProviderHealth struct {
+	Name                string     `json:"name"`
+	Enabled             bool       `json:"enabled"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
 }
 
 type Flight struct {
@@ -55,6 +223,26 @@ type Flight struct {
 	Aircraft       *string   `json:"aircraft"`
 	Amenities      []string  `json:"amenities"`
 	Baggage        Baggage   `json:"baggage"`
+	Segments       []Segment `json:"segments,omitempty"`
+	Layovers       []Layover `json:"layovers,omitempty"`
+	SelfTransfer   bool      `json:"self_transfer,omitempty"` // separately ticketed flights stitched by the aggregator
+}
+
+// Segment is a single flown leg of a flight.
+type Segment struct {
+	FlightNumber string   `json:"flight_number"`
+	Departure    Event    `json:"departure"`
+	Arrival      Event    `json:"arrival"`
+	Aircraft     *string  `json:"aircraft,omitempty"`
+	Duration     Duration `json:"duration"`
+}
+
+// Layover is the time spent on the ground between two segments.
+type Layover struct {
+	Airport         string `json:"airport"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Overnight       bool   `json:"overnight"`       // next segment leaves on a later local date
+	TerminalChange  bool   `json:"terminal_change"` // arrival and departure terminals differ
 }
 
 type Airline struct {
@@ -65,6 +253,7 @@ type Airline struct {
 type Event struct {
 	Airport   string `json:"airport"`
 	City      string `json:"city"`
+	Terminal  string `json:"terminal,omitempty"`
 	Datetime  string `json:"datetime"`
 	Timestamp int64  `json:"timestamp"`
 }
@@ -77,6 +266,22 @@ type Duration struct {
 type Price struct {
 	Amount   int    `json:"amount"`
 	Currency string `json:"currency"`
+	BaseFare int    `json:"base_fare,omitempty"` // fare before taxes, when the provider breaks it down
+	Taxes    int    `json:"taxes,omitempty"`
+}
+
+// NewLayover describes the connection between an arriving and a departing segment.
+// When the layover length isn't known it is derived from the timestamps.
+func NewLayover(arr, dep Event, minutes int) Layover {
+	if minutes == 0 && arr.Timestamp > 0 && dep.Timestamp > arr.Timestamp {
+		minutes = int((dep.Timestamp - arr.Timestamp) / 60)
+	}
+	return Layover{
+		Airport:         arr.Airport,
+		DurationMinutes: minutes,
+		Overnight:       len(arr.Datetime) >= 10 && len(dep.Datetime) >= 10 && arr.Datetime[:10] != dep.Datetime[:10],
+		TerminalChange:  arr.Terminal != "" && dep.Terminal != "" && arr.Terminal != dep.Terminal,
+	}
 }
 
 type Baggage struct {
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Machine readable validation codes returned to API clients.
+const (
+	CodeRequired      = "required"
+	CodeInvalidFormat = "invalid_format"
+	CodeInPast        = "in_past"
+	CodeOutOfRange    = "out_of_range"
+	CodeInvalidRange  = "invalid_range"
+	CodeUnsupported   = "unsupported_value"
+)
+
+const (
+	dateLayout    = "2006-01-02"
+	maxPassengers = 9
+	maxLegs       = 6
+	maxFlexDays   = 7
+)
+
+var (
+	iataPattern      = regexp.MustCompile(`^[A-Z]{3}$`)
+	clockPattern     = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+	validCabins      = []string{"economy", "premium_economy", "business", "first"}
+	validSortOptions = []string{"price_asc", "price_desc", "duration_asc", "duration_desc", "departure_asc", "departure_desc", "arrival_asc", "arrival_desc"}
+)
+
+// FieldError describes one invalid request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Add records an invalid field.
+func (e *ValidationError) Add(field, code, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns nil when no field was recorded, so callers can return it directly.
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate checks every field of the request and reports all problems at once.
+// Dates are compared against the calendar day of now.
+func (r SearchRequest) Validate(now time.Time) error {
+	v := &ValidationError{}
+
+	validateAirport(v, "origin", r.Origin)
+	validateAirport(v, "destination", r.Destination)
+	if r.Origin != "" && r.Origin == r.Destination {
+		v.Add("destination", CodeInvalidRange, "must differ from origin")
+	}
+
+	today := now.Format(dateLayout)
+	depDate, depOK := validateDate(v, "departure_date", r.DepartureDate, today)
+	if r.ReturnDate != nil {
+		retDate, retOK := validateDate(v, "returnDate", *r.ReturnDate, today)
+		if depOK && retOK && retDate.Before(depDate) {
+			v.Add("returnDate", CodeInvalidRange, "must not be before departure_date")
+		}
+	}
+
+	if r.Passengers != "" {
+		n, err := strconv.Atoi(r.Passengers)
+		switch {
+		case err != nil:
+			v.Add("passengers", CodeInvalidFormat, "must be a whole number")
+		case n < 1 || n > maxPassengers:
+			v.Add("passengers", CodeOutOfRange, "must be between 1 and %d", maxPassengers)
+		}
+	}
+	if r.CabinClass != "" && !contains(validCabins, r.CabinClass) {
+		v.Add("cabinClass", CodeUnsupported, "must be one of %s", strings.Join(validCabins, ", "))
+	}
+	if r.SortBy != nil && *r.SortBy != "" && !contains(validSortOptions, *r.SortBy) {
+		v.Add("sort_by", CodeUnsupported, "must be one of %s", strings.Join(validSortOptions, ", "))
+	}
+
+	if r.FlexDays != nil && (*r.FlexDays < 0 || *r.FlexDays > maxFlexDays) {
+		v.Add("flex_days", CodeOutOfRange, "must be between 0 and %d", maxFlexDays)
+	}
+
+	validateIntRange(v, "min_price", "max_price", r.MinPrice, r.MaxPrice)
+	validateIntRange(v, "min_stops", "max_stops", r.MinStops, r.MaxStops)
+	validateIntRange(v, "min_duration_minutes", "max_duration_minutes", r.MinDurationMinutes, r.MaxDurationMinutes)
+	validateClockWindow(v, "departure_time_start", "departure_time_end", r.DepartureTimeStart, r.DepartureTimeEnd)
+	validateClockWindow(v, "arrival_time_start", "arrival_time_end", r.ArrivalTimeStart, r.ArrivalTimeEnd)
+
+	return v.Err()
+}
+
+// Validate checks the trip shape and every leg, reporting leg fields as "legs[i].field".
+func (r MultiCityRequest) Validate(now time.Time) error {
+	v := &ValidationError{}
+
+	if len(r.Legs) < 2 || len(r.Legs) > maxLegs {
+		v.Add("legs", CodeOutOfRange, "must contain between 2 and %d legs", maxLegs)
+	}
+	for i := range r.Legs {
+		if err := r.LegRequest(i).Validate(now); err != nil {
+			for _, f := range err.(*ValidationError).Fields {
+				// Shared fields are reported once, below
+				if i > 0 && !isLegField(f.Field) {
+					continue
+				}
+				if isLegField(f.Field) {
+					f.Field = fmt.Sprintf("legs[%d].%s", i, f.Field)
+				}
+				v.Fields = append(v.Fields, f)
+			}
+		}
+		if i > 0 && r.Legs[i].DepartureDate != "" && r.Legs[i].DepartureDate < r.Legs[i-1].DepartureDate {
+			v.Add(fmt.Sprintf("legs[%d].departure_date", i), CodeInvalidRange, "must not be before the previous leg")
+		}
+	}
+
+	if r.MinConnectionMinutes != nil && *r.MinConnectionMinutes < 0 {
+		v.Add("min_connection_minutes", CodeOutOfRange, "must not be negative")
+	}
+	validateIntRange(v, "min_price", "max_price", r.MinPrice, r.MaxPrice)
+	if r.SortBy != nil && *r.SortBy != "" && !contains(validSortOptions, *r.SortBy) {
+		v.Add("sort_by", CodeUnsupported, "must be one of %s", strings.Join(validSortOptions, ", "))
+	}
+	return v.Err()
+}
+
+func isLegField(field string) bool {
+	return field == "origin" || field == "destination" || field == "departure_date"
+}
+
+func validateAirport(v *ValidationError, field, code string) {
+	if code == "" {
+		v.Add(field, CodeRequired, "is required")
+		return
+	}
+	if !iataPattern.MatchString(code) {
+		v.Add(field, CodeInvalidFormat, "must be a 3-letter uppercase IATA code")
+	}
+}
+
+func validateDate(v *ValidationError, field, value, today string) (time.Time, bool) {
+	if value == "" {
+		v.Add(field, CodeRequired, "is required")
+		return time.Time{}, false
+	}
+	d, err := time.Parse(dateLayout, value)
+	if err != nil {
+		v.Add(field, CodeInvalidFormat, "must be a date in YYYY-MM-DD format")
+		return time.Time{}, false
+	}
+	// Both sides are YYYY-MM-DD so lexical order is chronological
+	if value < today {
+		v.Add(field, CodeInPast, "must not be before %s", today)
+		return d, false
+	}
+	return d, true
+}
+
+func validateIntRange(v *ValidationError, minField, maxField string, min, max *int) {
+	if min != nil && *min < 0 {
+		v.Add(minField, CodeOutOfRange, "must not be negative")
+	}
+	if max != nil && *max < 0 {
+		v.Add(maxField, CodeOutOfRange, "must not be negative")
+	}
+	if min != nil && max != nil && *min > *max {
+		v.Add(minField, CodeInvalidRange, "must not be greater than %s", maxField)
+	}
+}
+
+// validateClockWindow ensures both ends of an "HH:MM" window are present and well formed,
+// which keeps the lexical comparison in the aggregator filter correct.
+func validateClockWindow(v *ValidationError, startField, endField string, start, end *string) {
+	if start == nil && end == nil {
+		return
+	}
+	if start == nil {
+		v.Add(startField, CodeRequired, "is required when %s is set", endField)
+	}
+	if end == nil {
+		v.Add(endField, CodeRequired, "is required when %s is set", startField)
+	}
+	valid := true
+	for _, w := range []struct {
+		field string
+		value *string
+	}{{startField, start}, {endField, end}} {
+		if w.value != nil && !clockPattern.MatchString(*w.value) {
+			v.Add(w.field, CodeInvalidFormat, "must be a 24-hour time in HH:MM format")
+			valid = false
+		}
+	}
+	if valid && start != nil && end != nil && *start > *end {
+		v.Add(startField, CodeInvalidRange, "must not be later than %s", endField)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
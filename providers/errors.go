@@ -0,0 +1,108 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrorKind classifies why a provider call failed.
+type ErrorKind string
+
+const (
+	// KindUnavailable is a temporary outage (5xx, maintenance, flaky network). Retryable.
+	KindUnavailable ErrorKind = "unavailable"
+	// KindRateLimited means the provider throttled us. Retryable after RetryAfter.
+	KindRateLimited ErrorKind = "rate_limited"
+	// KindBadRequest means the provider rejected the search itself.
+	KindBadRequest ErrorKind = "bad_request"
+	// KindNoAvailability means the provider answered but has nothing on the route or date.
+	KindNoAvailability ErrorKind = "no_availability"
+	// KindAuth is a rejected or expired credential.
+	KindAuth ErrorKind = "auth_failed"
+	// KindMalformedResponse is a payload that could not be decoded or mapped.
+	KindMalformedResponse ErrorKind = "malformed_response"
+)
+
+// Error is a classified provider failure. Its message is the underlying error's, so
+// wrapping an existing error doesn't change what callers see.
+type Error struct {
+	Kind       ErrorKind
+	RetryAfter time.Duration // only set for KindRateLimited, zero when the provider gave no hint
+	Err        error
+}
+
+// Errorf builds an *Error of the given kind. The format supports %w.
+func Errorf(kind ErrorKind, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// RateLimited builds a KindRateLimited error asking to wait retryAfter before the next call.
+func RateLimited(retryAfter time.Duration, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindRateLimited, RetryAfter: retryAfter, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return string(e.Kind)
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Retryable reports whether calling the provider again may succeed.
+func (e *Error) Retryable() bool {
+	return e.Kind == KindUnavailable || e.Kind == KindRateLimited
+}
+
+// IsRetryable reports whether err is worth retrying. Cancellation never is, and neither
+// is a bare context deadline since the caller has given up; a deadline classified as
+// KindUnavailable (e.g. a single attempt timing out) is. Unclassified errors are retried,
+// as before this taxonomy.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.Retryable()
+	}
+	return !errors.Is(err, context.DeadlineExceeded)
+}
+
+// RetryAfter returns the wait requested by a rate-limited provider, or zero.
+func RetryAfter(err error) time.Duration {
+	var perr *Error
+	if errors.As(err, &perr) && perr.Kind == KindRateLimited {
+		return perr.RetryAfter
+	}
+	return 0
+}
+
+// KindOf returns the kind of a classified error and false for anything else.
+func KindOf(err error) (ErrorKind, bool) {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.Kind, true
+	}
+	return "", false
+}
+
+// KindForStatus maps an HTTP-style status code reported by a provider to an error kind.
+func KindForStatus(code int) ErrorKind {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return KindRateLimited
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return KindAuth
+	case code == http.StatusNotFound:
+		return KindNoAvailability
+	case code >= 400 && code < 500:
+		return KindBadRequest
+	default:
+		return KindUnavailable
+	}
+}
@@ -0,0 +1,346 @@
+package providers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"flight-aggregator/models"
+)
+
+// DefaultMaxResponseBytes caps a decoded provider response unless configured otherwise.
+const DefaultMaxResponseBytes = 5 << 20
+
+// RequestTemplate describes how a search becomes an HTTP request. Path, query values and
+// body are text/template strings executed against the models.SearchRequest, e.g.
+// "/flights/{{.Origin}}" or `{"from": {{json .Origin}}}`. The upper, lower and json
+// functions are available. Query parameters that render empty are left out.
+type RequestTemplate struct {
+	Method      string // defaults to GET
+	Path        string
+	Query       map[string]string
+	Body        string
+	ContentType string // defaults to application/json when there is a body
+}
+
+// ResponseMapper converts a decoded response body into flights. It reports payload
+// level failures as classified errors, like the mock providers do.
+type ResponseMapper func(data []byte) ([]models.Flight, error)
+
+// HTTPAdapter is the airline specific part of an HTTP provider.
+type HTTPAdapter struct {
+	Name       string
+	Request    RequestTemplate
+	AuthHeader string // header carrying the API key; "Authorization" is sent as a bearer token
+	Map        ResponseMapper
+}
+
+// HTTPConfig holds the deployment specific settings of an HTTP provider.
+type HTTPConfig struct {
+	BaseURL          string
+	APIKey           string
+	Headers          map[string]string
+	MaxResponseBytes int64        // defaults to DefaultMaxResponseBytes
+	Client           *http.Client // defaults to http.DefaultClient, calls are bounded by the context
+}
+
+// HTTPProvider searches an airline over HTTP, leaving the request shape and the
+// payload mapping to its adapter.
+type HTTPProvider struct {
+	adapter HTTPAdapter
+	cfg     HTTPConfig
+	base    *url.URL
+	path    *template.Template
+	query   map[string]*template.Template
+	body    *template.Template
+}
+
+var requestFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// NewHTTPProvider checks the configuration and parses the request templates up front,
+// so a broken adapter fails at startup rather than on the first search.
+func NewHTTPProvider(adapter HTTPAdapter, cfg HTTPConfig) (*HTTPProvider, error) {
+	if adapter.Name == "" || adapter.Map == nil {
+		return nil, errors.New("http adapter needs a name and a response mapper")
+	}
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", cfg.BaseURL)
+	}
+	if cfg.MaxResponseBytes <= 0 {
+		cfg.MaxResponseBytes = DefaultMaxResponseBytes
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	p := &HTTPProvider{adapter: adapter, cfg: cfg, base: base, query: make(map[string]*template.Template)}
+	if p.path, err = parseRequestTemplate("path", adapter.Request.Path); err != nil {
+		return nil, err
+	}
+	for key, text := range adapter.Request.Query {
+		if p.query[key], err = parseRequestTemplate("query "+key, text); err != nil {
+			return nil, err
+		}
+	}
+	if adapter.Request.Body != "" {
+		if p.body, err = parseRequestTemplate("body", adapter.Request.Body); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func parseRequestTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(requestFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("request template: %w", err)
+	}
+	return t, nil
+}
+
+func (p *HTTPProvider) Name() string { return p.adapter.Name }
+
+func (p *HTTPProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	httpReq, err := p.newRequest(ctx, req)
+	if err != nil {
+		return nil, Errorf(KindBadRequest, "%s: building request: %w", p.Name(), err)
+	}
+	resp, err := p.cfg.Client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, Errorf(KindUnavailable, "%s: %w", p.Name(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, p.statusError(resp)
+	}
+	data, err := p.readBody(ctx, resp)
+	if err != nil {
+		return nil, err
+	}
+	return p.adapter.Map(data)
+}
+
+func (p *HTTPProvider) newRequest(ctx context.Context, req models.SearchRequest) (*http.Request, error) {
+	path, err := render(p.path, req)
+	if err != nil {
+		return nil, err
+	}
+	u := p.base.JoinPath(path)
+	q := u.Query()
+	for key, t := range p.query {
+		v, err := render(t, req)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			q.Set(key, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	method := p.adapter.Request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if p.body != nil {
+		b, err := render(p.body, req)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(b)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Accept", "application/json")
+	// Asking for gzip ourselves turns off the transport's transparent decoding, so
+	// readBody can apply the size limit to the decoded payload.
+	httpReq.Header.Set("Accept-Encoding", "gzip")
+	if body != nil {
+		contentType := p.adapter.Request.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if p.cfg.APIKey != "" && p.adapter.AuthHeader != "" {
+		if strings.EqualFold(p.adapter.AuthHeader, "Authorization") {
+			httpReq.Header.Set("Authorization", "Bearer "+p.cfg.APIKey)
+		} else {
+			httpReq.Header.Set(p.adapter.AuthHeader, p.cfg.APIKey)
+		}
+	}
+	for k, v := range p.cfg.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	return httpReq, nil
+}
+
+func render(t *template.Template, req models.SearchRequest) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, req); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// statusError classifies a non-2xx answer, keeping the start of the body for context.
+func (p *HTTPProvider) statusError(resp *http.Response) error {
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	msg := fmt.Sprintf("%s API error: %s", p.Name(), resp.Status)
+	if s := strings.TrimSpace(string(snippet)); s != "" {
+		msg += ": " + s
+	}
+	kind := KindForStatus(resp.StatusCode)
+	if kind == KindRateLimited {
+		return RateLimited(parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()), "%s", msg)
+	}
+	return Errorf(kind, "%s", msg)
+}
+
+// readBody reads the response, decoding gzip, and rejects payloads over the size limit.
+func (p *HTTPProvider) readBody(ctx context.Context, resp *http.Response) ([]byte, error) {
+	limit := p.cfg.MaxResponseBytes
+	gzipped := strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip")
+	if !gzipped && resp.ContentLength > limit {
+		return nil, Errorf(KindMalformedResponse, "%s: response of %d bytes exceeds the %d byte limit", p.Name(), resp.ContentLength, limit)
+	}
+
+	var r io.Reader = resp.Body
+	if gzipped {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, Errorf(KindMalformedResponse, "%s: invalid gzip body: %w", p.Name(), err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader):
+			return nil, Errorf(KindMalformedResponse, "%s: invalid gzip body: %w", p.Name(), err)
+		default:
+			return nil, Errorf(KindUnavailable, "%s: reading response: %w", p.Name(), err)
+		}
+	}
+	if int64(len(data)) > limit {
+		return nil, Errorf(KindMalformedResponse, "%s: response exceeds the %d byte limit", p.Name(), limit)
+	}
+	return data, nil
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// HTTP adapters for the bundled airlines. They share the response mappers of the mock
+// providers, so a live API and the sample payloads produce identical flights.
+
+// GarudaHTTPAdapter searches Garuda Indonesia with a GET and an X-Api-Key header.
+func GarudaHTTPAdapter() HTTPAdapter {
+	return HTTPAdapter{
+		Name: (&GarudaProvider{}).Name(),
+		Request: RequestTemplate{
+			Path: "/v1/flights/search",
+			Query: map[string]string{
+				"origin":         "{{.Origin}}",
+				"destination":    "{{.Destination}}",
+				"departure_date": "{{.DepartureDate}}",
+				"passengers":     "{{.Passengers}}",
+				"cabin_class":    "{{lower .CabinClass}}",
+			},
+		},
+		AuthHeader: "X-Api-Key",
+		Map:        (&GarudaProvider{}).mapResponse,
+	}
+}
+
+// AirAsiaHTTPAdapter searches AirAsia with a GET and a bearer token.
+func AirAsiaHTTPAdapter() HTTPAdapter {
+	return HTTPAdapter{
+		Name: (&AirAsiaProvider{}).Name(),
+		Request: RequestTemplate{
+			Path: "/api/search",
+			Query: map[string]string{
+				"from": "{{.Origin}}",
+				"to":   "{{.Destination}}",
+				"date": "{{.DepartureDate}}",
+				"pax":  "{{.Passengers}}",
+			},
+		},
+		AuthHeader: "Authorization",
+		Map:        (&AirAsiaProvider{}).mapResponse,
+	}
+}
+
+// BatikAirHTTPAdapter searches Batik Air by POSTing a JSON availability request.
+func BatikAirHTTPAdapter() HTTPAdapter {
+	return HTTPAdapter{
+		Name: (&BatikAirProvider{}).Name(),
+		Request: RequestTemplate{
+			Method: http.MethodPost,
+			Path:   "/v2/availability",
+			Body: `{"origin":{{json .Origin}},"destination":{{json .Destination}},` +
+				`"departureDate":{{json .DepartureDate}},"passengers":{{json .Passengers}},"cabinClass":{{json .CabinClass}}}`,
+		},
+		AuthHeader: "X-Api-Key",
+		Map:        (&BatikAirProvider{}).mapResponse,
+	}
+}
+
+// LionAirHTTPAdapter searches Lion Air with a GET and a bearer token.
+func LionAirHTTPAdapter() HTTPAdapter {
+	return HTTPAdapter{
+		Name: (&LionAirProvider{}).Name(),
+		Request: RequestTemplate{
+			Path: "/search/flights",
+			Query: map[string]string{
+				"from":   "{{.Origin}}",
+				"to":     "{{.Destination}}",
+				"date":   "{{.DepartureDate}}",
+				"adults": "{{.Passengers}}",
+			},
+		},
+		AuthHeader: "Authorization",
+		Map:        (&LionAirProvider{}).mapResponse,
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	_ "time/tzdata" // provider payloads name IANA zones, don't depend on the host zoneinfo
 
+	"flight-aggregator/airports"
 	"flight-aggregator/models"
 )
 
@@ -30,7 +32,7 @@ func simulateDelay(ctx context.Context, minMs, maxMs int) error {
 	}
 }
 
-func readMockData(filename string, target interface{}) error {
+func readMockData(filename string) ([]byte, error) {
 	// Try local mock_data first
 	path := filepath.Join("mock_data", filename)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -39,9 +41,77 @@ func readMockData(filename string, target interface{}) error {
 	}
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return nil, &Error{Kind: KindUnavailable, Err: err}
 	}
-	return json.Unmarshal(data, target)
+	return data, nil
+}
+
+// decodeResponse unmarshals a provider payload, classifying failures as malformed.
+func decodeResponse(data []byte, target interface{}) error {
+	if err := json.Unmarshal(data, target); err != nil {
+		return &Error{Kind: KindMalformedResponse, Err: err}
+	}
+	return nil
+}
+
+// directSegment describes a nonstop flight as its own single segment. Providers that
+// only report stop airports without per-leg times get no segments rather than invented ones.
+func directSegment(f models.Flight) []models.Segment {
+	if f.Stops > 0 {
+		return nil
+	}
+	return []models.Segment{{
+		FlightNumber: f.FlightNumber,
+		Departure:    f.Departure,
+		Arrival:      f.Arrival,
+		Aircraft:     f.Aircraft,
+		Duration:     f.Duration,
+	}}
+}
+
+// redate moves the sample flights onto the requested departure date, keeping local
+// times and offsets, so the simulated providers can answer for any day.
+func redate(flights []models.Flight, date string) []models.Flight {
+	target, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return flights
+	}
+	for i := range flights {
+		f := &flights[i]
+		dep, err := time.Parse(time.RFC3339, f.Departure.Datetime)
+		if err != nil {
+			continue
+		}
+		sampleDay := time.Date(dep.Year(), dep.Month(), dep.Day(), 0, 0, 0, 0, time.UTC)
+		days := int(target.Sub(sampleDay).Hours() / 24)
+		if days == 0 {
+			continue
+		}
+		shiftEvent(&f.Departure, days)
+		shiftEvent(&f.Arrival, days)
+		for j := range f.Segments {
+			shiftEvent(&f.Segments[j].Departure, days)
+			shiftEvent(&f.Segments[j].Arrival, days)
+		}
+	}
+	return flights
+}
+
+func shiftEvent(e *models.Event, days int) {
+	t, err := time.Parse(time.RFC3339, e.Datetime)
+	if err != nil {
+		return
+	}
+	t = t.AddDate(0, 0, days)
+	e.Datetime = t.Format(time.RFC3339)
+	e.Timestamp = t.Unix()
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
 }
 
 // --- GARUDA INDONESIA --- //
@@ -52,27 +122,46 @@ func (g *GarudaProvider) FetchFlights(ctx context.Context, req models.SearchRequ
 	if err := simulateDelay(ctx, 50, 100); err != nil {
 		return nil, err
 	}
+	data, err := readMockData("garuda_indonesia_search_response.json")
+	if err != nil {
+		return nil, err
+	}
+	results, err := g.mapResponse(data)
+	if err != nil {
+		return nil, err
+	}
+	return redate(results, req.DepartureDate), nil
+}
 
+// mapResponse converts a Garuda Indonesia search payload into flights.
+func (g *GarudaProvider) mapResponse(data []byte) ([]models.Flight, error) {
 	var mock struct {
 		Flights []struct {
-			FlightId string                               `json:"flight_id"`
-			Airline  string                               `json:"airline"`
-			AirlineC string                               `json:"airline_code"`
-			Dep      struct{ Airport, City, Time string } `json:"departure"`
-			Arr      struct{ Airport, City, Time string } `json:"arrival"`
-			DurMins  int                                  `json:"duration_minutes"`
-			Stops    int                                  `json:"stops"`
-			Aircraft string                               `json:"aircraft"`
-			Price    struct{ Amount int }                 `json:"price"`
-			Seats    int                                  `json:"available_seats"`
+			FlightId string                                         `json:"flight_id"`
+			Airline  string                                         `json:"airline"`
+			AirlineC string                                         `json:"airline_code"`
+			Dep      struct{ Airport, City, Time, Terminal string } `json:"departure"`
+			Arr      struct{ Airport, City, Time, Terminal string } `json:"arrival"`
+			DurMins  int                                            `json:"duration_minutes"`
+			Stops    int                                            `json:"stops"`
+			Aircraft string                                         `json:"aircraft"`
+			Price    struct{ Amount int }                           `json:"price"`
+			Seats    int                                            `json:"available_seats"`
 			Baggage  struct {
 				CarryOn int
 				Checked int
 			} `json:"baggage"`
+			Segments []struct {
+				FlightNumber string                         `json:"flight_number"`
+				Dep          struct{ Airport, Time string } `json:"departure"`
+				Arr          struct{ Airport, Time string } `json:"arrival"`
+				DurMins      int                            `json:"duration_minutes"`
+				LayoverMins  int                            `json:"layover_minutes"`
+			} `json:"segments"`
 		} `json:"flights"`
 	}
 
-	if err := readMockData("garuda_indonesia_search_response.json", &mock); err != nil {
+	if err := decodeResponse(data, &mock); err != nil {
 		return nil, err
 	}
 
@@ -81,17 +170,57 @@ func (g *GarudaProvider) FetchFlights(ctx context.Context, req models.SearchRequ
 		depT, _ := time.Parse(time.RFC3339, f.Dep.Time)
 		arrT, _ := time.Parse(time.RFC3339, f.Arr.Time)
 
-		results = append(results, models.Flight{
+		flight := models.Flight{
 			ID: fmt.Sprintf("%s_Garuda", f.FlightId), Provider: g.Name(),
 			Airline:      models.Airline{Name: f.Airline, Code: f.AirlineC},
 			FlightNumber: f.FlightId,
-			Departure:    models.Event{Airport: f.Dep.Airport, City: f.Dep.City, Datetime: f.Dep.Time, Timestamp: depT.Unix()},
-			Arrival:      models.Event{Airport: f.Arr.Airport, City: f.Arr.City, Datetime: f.Arr.Time, Timestamp: arrT.Unix()},
+			Departure:    models.Event{Airport: f.Dep.Airport, City: f.Dep.City, Terminal: f.Dep.Terminal, Datetime: f.Dep.Time, Timestamp: depT.Unix()},
+			Arrival:      models.Event{Airport: f.Arr.Airport, City: f.Arr.City, Terminal: f.Arr.Terminal, Datetime: f.Arr.Time, Timestamp: arrT.Unix()},
 			Duration:     models.Duration{TotalMinutes: f.DurMins, Formatted: fmt.Sprintf("%dh %dm", f.DurMins/60, f.DurMins%60)},
 			Stops:        f.Stops, AvailableSeats: f.Seats,
-			Price:   models.Price{Amount: f.Price.Amount, Currency: "IDR"},
-			Baggage: models.Baggage{CarryOn: fmt.Sprintf("%d piece(s)", f.Baggage.CarryOn), Checked: fmt.Sprintf("%d piece(s)", f.Baggage.Checked)},
-		})
+			Aircraft: optionalString(f.Aircraft),
+			Price:    models.Price{Amount: f.Price.Amount, Currency: "IDR"},
+			Baggage:  models.Baggage{CarryOn: fmt.Sprintf("%d piece(s)", f.Baggage.CarryOn), Checked: fmt.Sprintf("%d piece(s)", f.Baggage.Checked)},
+		}
+
+		if len(f.Segments) == 0 {
+			flight.Segments = directSegment(flight)
+			results = append(results, flight)
+			continue
+		}
+
+		// Segments describe the full journey, the top level only the first leg
+		cities := map[string]string{f.Dep.Airport: f.Dep.City, f.Arr.Airport: f.Arr.City}
+		for _, seg := range f.Segments {
+			for _, code := range []string{seg.Dep.Airport, seg.Arr.Airport} {
+				if cities[code] == "" {
+					cities[code] = airports.CityName(code)
+				}
+			}
+		}
+		for i, seg := range f.Segments {
+			segDep, _ := time.Parse(time.RFC3339, seg.Dep.Time)
+			segArr, _ := time.Parse(time.RFC3339, seg.Arr.Time)
+			segment := models.Segment{
+				FlightNumber: seg.FlightNumber,
+				Departure:    models.Event{Airport: seg.Dep.Airport, City: cities[seg.Dep.Airport], Datetime: seg.Dep.Time, Timestamp: segDep.Unix()},
+				Arrival:      models.Event{Airport: seg.Arr.Airport, City: cities[seg.Arr.Airport], Datetime: seg.Arr.Time, Timestamp: segArr.Unix()},
+				Duration:     models.Duration{TotalMinutes: seg.DurMins, Formatted: fmt.Sprintf("%dh %dm", seg.DurMins/60, seg.DurMins%60)},
+			}
+			if i == 0 {
+				segment.Departure.Terminal = f.Dep.Terminal
+				segment.Aircraft = flight.Aircraft
+			} else {
+				prev := flight.Segments[i-1].Arrival
+				flight.Layovers = append(flight.Layovers, models.NewLayover(prev, segment.Departure, seg.LayoverMins))
+			}
+			flight.Segments = append(flight.Segments, segment)
+		}
+		flight.Arrival = flight.Segments[len(flight.Segments)-1].Arrival
+		if stops := len(flight.Segments) - 1; stops > flight.Stops {
+			flight.Stops = stops
+		}
+		results = append(results, flight)
 	}
 	return results, nil
 }
@@ -107,9 +236,21 @@ func (a *AirAsiaProvider) FetchFlights(ctx context.Context, req models.SearchReq
 
 	// Simulate 10% failure rate
 	if rand.Intn(10) == 0 {
-		return nil, fmt.Errorf("AirAsia API Service Unavailable (503)")
+		return nil, Errorf(KindUnavailable, "AirAsia API Service Unavailable (503)")
 	}
+	data, err := readMockData("airasia_search_response.json")
+	if err != nil {
+		return nil, err
+	}
+	results, err := a.mapResponse(data)
+	if err != nil {
+		return nil, err
+	}
+	return redate(results, req.DepartureDate), nil
+}
 
+// mapResponse converts an AirAsia search payload into flights.
+func (a *AirAsiaProvider) mapResponse(data []byte) ([]models.Flight, error) {
 	var mock struct {
 		Flights []struct {
 			Code   string  `json:"flight_code"`
@@ -122,10 +263,14 @@ func (a *AirAsiaProvider) FetchFlights(ctx context.Context, req models.SearchReq
 			Price  int     `json:"price_idr"`
 			Seats  int     `json:"seats"`
 			Bag    string  `json:"baggage_note"`
+			Stops  []struct {
+				Airport  string `json:"airport"`
+				WaitMins int    `json:"wait_time_minutes"`
+			} `json:"stops"`
 		} `json:"flights"`
 	}
 
-	if err := readMockData("airasia_search_response.json", &mock); err != nil {
+	if err := decodeResponse(data, &mock); err != nil {
 		return nil, err
 	}
 
@@ -138,17 +283,25 @@ func (a *AirAsiaProvider) FetchFlights(ctx context.Context, req models.SearchReq
 		if !f.Direct {
 			stops = 1
 		}
+		if len(f.Stops) > stops {
+			stops = len(f.Stops)
+		}
 
-		results = append(results, models.Flight{
+		flight := models.Flight{
 			ID: fmt.Sprintf("%s_AirAsia", f.Code), Provider: a.Name(),
 			Airline:      models.Airline{Name: "AirAsia", Code: strings.TrimRight(f.Code, "0123456789")},
 			FlightNumber: f.Code,
-			Departure:    models.Event{Airport: f.From, Datetime: f.Dep, Timestamp: depT.Unix()},
-			Arrival:      models.Event{Airport: f.To, Datetime: f.Arr, Timestamp: arrT.Unix()},
+			Departure:    models.Event{Airport: f.From, City: airports.CityName(f.From), Datetime: f.Dep, Timestamp: depT.Unix()},
+			Arrival:      models.Event{Airport: f.To, City: airports.CityName(f.To), Datetime: f.Arr, Timestamp: arrT.Unix()},
 			Duration:     models.Duration{TotalMinutes: mins, Formatted: fmt.Sprintf("%dh %dm", mins/60, mins%60)},
 			Stops:        stops, Price: models.Price{Amount: f.Price, Currency: "IDR"}, AvailableSeats: f.Seats,
 			Baggage: models.Baggage{CarryOn: "Included", Checked: f.Bag},
-		})
+		}
+		for _, stop := range f.Stops {
+			flight.Layovers = append(flight.Layovers, models.Layover{Airport: stop.Airport, DurationMinutes: stop.WaitMins})
+		}
+		flight.Segments = directSegment(flight)
+		results = append(results, flight)
 	}
 	return results, nil
 }
@@ -156,103 +309,328 @@ func (a *AirAsiaProvider) FetchFlights(ctx context.Context, req models.SearchReq
 // --- Batik Air --- //
 type BatikAirProvider struct{}
 
+// batikAirResponse mirrors the camelCase Batik Air search payload.
+type batikAirResponse struct {
+	Code    int              `json:"code"`
+	Message string           `json:"message"`
+	Results []batikAirFlight `json:"results"`
+}
+
+type batikAirFlight struct {
+	FlightNumber      string `json:"flightNumber"`
+	AirlineName       string `json:"airlineName"`
+	AirlineIATA       string `json:"airlineIATA"`
+	Origin            string `json:"origin"`
+	Destination       string `json:"destination"`
+	DepartureDateTime string `json:"departureDateTime"`
+	ArrivalDateTime   string `json:"arrivalDateTime"`
+	TravelTime        string `json:"travelTime"`
+	NumberOfStops     int    `json:"numberOfStops"`
+	Fare              struct {
+		BasePrice    int    `json:"basePrice"`
+		Taxes        int    `json:"taxes"`
+		TotalPrice   int    `json:"totalPrice"`
+		CurrencyCode string `json:"currencyCode"`
+		Class        string `json:"class"`
+	} `json:"fare"`
+	Connections []struct {
+		StopAirport  string `json:"stopAirport"`
+		StopDuration string `json:"stopDuration"`
+	} `json:"connections"`
+	SeatsAvailable  int      `json:"seatsAvailable"`
+	AircraftModel   string   `json:"aircraftModel"`
+	BaggageInfo     string   `json:"baggageInfo"`
+	OnboardServices []string `json:"onboardServices"`
+}
+
+// Batik Air sends numeric offsets without a colon ("+0700"), which time.RFC3339 rejects.
+const batikAirTimeLayout = "2006-01-02T15:04:05-0700"
+
+// batikFareClasses maps IATA booking class codes to cabin classes.
+var batikFareClasses = map[string]string{
+	"Y": "economy",
+	"W": "premium_economy",
+	"C": "business",
+	"J": "business",
+	"F": "first",
+}
+
 func (b *BatikAirProvider) Name() string { return "Batik Air" }
 func (b *BatikAirProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
 	if err := simulateDelay(ctx, 200, 400); err != nil {
 		return nil, err
 	}
 
-	var mock struct {
-		Flights []struct {
-			FlightId string                               `json:"flight_id"`
-			Airline  string                               `json:"airline"`
-			AirlineC string                               `json:"airline_code"`
-			Dep      struct{ Airport, City, Time string } `json:"departure"`
-			Arr      struct{ Airport, City, Time string } `json:"arrival"`
-			DurMins  int                                  `json:"duration_minutes"`
-			Stops    int                                  `json:"stops"`
-			Aircraft string                               `json:"aircraft"`
-			Price    struct{ Amount int }                 `json:"price"`
-			Seats    int                                  `json:"available_seats"`
-			Baggage  struct {
-				CarryOn int
-				Checked int
-			} `json:"baggage"`
-		} `json:"flights"`
+	data, err := readMockData("batik_air_search_response.json")
+	if err != nil {
+		return nil, err
 	}
-
-	if err := readMockData("batik_air_search_response.json", &mock); err != nil {
+	results, err := b.mapResponse(data)
+	if err != nil {
 		return nil, err
 	}
+	return redate(results, req.DepartureDate), nil
+}
 
-	var results []models.Flight
-	for _, f := range mock.Flights {
-		depT, _ := time.Parse(time.RFC3339, f.Dep.Time)
-		arrT, _ := time.Parse(time.RFC3339, f.Arr.Time)
+// mapResponse converts a Batik Air search payload into flights. The payload carries
+// its own status code, which can report an error even on an HTTP 200.
+func (b *BatikAirProvider) mapResponse(data []byte) ([]models.Flight, error) {
+	var mock batikAirResponse
+	if err := decodeResponse(data, &mock); err != nil {
+		return nil, err
+	}
+	if mock.Code != 200 {
+		return nil, Errorf(KindForStatus(mock.Code), "Batik Air API error %d: %s", mock.Code, mock.Message)
+	}
 
-		results = append(results, models.Flight{
-			ID: fmt.Sprintf("%s_Batik", f.FlightId), Provider: b.Name(),
-			Airline:      models.Airline{Name: f.Airline, Code: f.AirlineC},
-			FlightNumber: f.FlightId,
-			Departure:    models.Event{Airport: f.Dep.Airport, City: f.Dep.City, Datetime: f.Dep.Time, Timestamp: depT.Unix()},
-			Arrival:      models.Event{Airport: f.Arr.Airport, City: f.Arr.City, Datetime: f.Arr.Time, Timestamp: arrT.Unix()},
-			Duration:     models.Duration{TotalMinutes: f.DurMins, Formatted: fmt.Sprintf("%dh %dm", f.DurMins/60, f.DurMins%60)},
-			Stops:        f.Stops, AvailableSeats: f.Seats,
-			Price:   models.Price{Amount: f.Price.Amount, Currency: "IDR"},
-			Baggage: models.Baggage{CarryOn: fmt.Sprintf("%d piece(s)", f.Baggage.CarryOn), Checked: fmt.Sprintf("%d piece(s)", f.Baggage.Checked)},
-		})
+	results := make([]models.Flight, 0, len(mock.Results))
+	for _, f := range mock.Results {
+		flight, err := b.toFlight(f)
+		if err != nil {
+			return nil, Errorf(KindMalformedResponse, "Batik Air flight %s: %w", f.FlightNumber, err)
+		}
+		results = append(results, flight)
 	}
 	return results, nil
 }
 
+func (b *BatikAirProvider) toFlight(f batikAirFlight) (models.Flight, error) {
+	depT, err := time.Parse(batikAirTimeLayout, f.DepartureDateTime)
+	if err != nil {
+		return models.Flight{}, fmt.Errorf("departure: %w", err)
+	}
+	arrT, err := time.Parse(batikAirTimeLayout, f.ArrivalDateTime)
+	if err != nil {
+		return models.Flight{}, fmt.Errorf("arrival: %w", err)
+	}
+	mins, err := parseTravelTime(f.TravelTime)
+	if err != nil {
+		return models.Flight{}, err
+	}
+
+	amenities := make([]string, 0, len(f.OnboardServices))
+	for _, svc := range f.OnboardServices {
+		amenities = append(amenities, strings.ToLower(strings.ReplaceAll(strings.TrimSpace(svc), " ", "_")))
+	}
+
+	var layovers []models.Layover
+	for _, c := range f.Connections {
+		wait, err := parseTravelTime(c.StopDuration)
+		if err != nil {
+			return models.Flight{}, fmt.Errorf("connection at %s: %w", c.StopAirport, err)
+		}
+		layovers = append(layovers, models.Layover{Airport: c.StopAirport, DurationMinutes: wait})
+	}
+
+	currency := f.Fare.CurrencyCode
+	if currency == "" {
+		currency = "IDR"
+	}
+
+	flight := models.Flight{
+		ID: fmt.Sprintf("%s_Batik", f.FlightNumber), Provider: b.Name(),
+		Airline:      models.Airline{Name: f.AirlineName, Code: f.AirlineIATA},
+		FlightNumber: f.FlightNumber,
+		Departure:    models.Event{Airport: f.Origin, City: airports.CityName(f.Origin), Datetime: depT.Format(time.RFC3339), Timestamp: depT.Unix()},
+		Arrival:      models.Event{Airport: f.Destination, City: airports.CityName(f.Destination), Datetime: arrT.Format(time.RFC3339), Timestamp: arrT.Unix()},
+		Duration:     models.Duration{TotalMinutes: mins, Formatted: fmt.Sprintf("%dh %dm", mins/60, mins%60)},
+		Stops:        f.NumberOfStops, AvailableSeats: f.SeatsAvailable,
+		Price:      models.Price{Amount: f.Fare.TotalPrice, Currency: currency, BaseFare: f.Fare.BasePrice, Taxes: f.Fare.Taxes},
+		CabinClass: batikFareClasses[strings.ToUpper(f.Fare.Class)],
+		Aircraft:   optionalString(f.AircraftModel),
+		Amenities:  amenities,
+		Baggage:    parseBaggageInfo(f.BaggageInfo),
+		Layovers:   layovers,
+	}
+	flight.Segments = directSegment(flight)
+	return flight, nil
+}
+
+// parseTravelTime converts free text such as "1h 45m", "3h 5m" or "55m" into minutes.
+func parseTravelTime(s string) (int, error) {
+	d, err := time.ParseDuration(strings.ReplaceAll(strings.TrimSpace(s), " ", ""))
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid travel time %q", s)
+	}
+	return int(d.Minutes()), nil
+}
+
+// parseBaggageInfo splits "7kg cabin, 20kg checked" into its cabin and checked allowances.
+// Parts without a recognised keyword are kept verbatim as the checked allowance.
+func parseBaggageInfo(s string) models.Baggage {
+	var bag models.Baggage
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lower := strings.ToLower(part)
+		switch {
+		case part == "":
+		case strings.HasSuffix(lower, " cabin"):
+			bag.CarryOn = strings.TrimSpace(part[:len(part)-len(" cabin")])
+		case strings.HasSuffix(lower, " checked"):
+			bag.Checked = strings.TrimSpace(part[:len(part)-len(" checked")])
+		case bag.Checked == "":
+			bag.Checked = part
+		}
+	}
+	return bag
+}
+
 // --- Lion Air --- //
 type LionAirProvider struct{}
 
+// lionAirResponse mirrors the Lion Air search payload. Schedule times are naive
+// local datetimes qualified by separate IANA timezone names.
+type lionAirResponse struct {
+	Success bool `json:"success"`
+	Data    struct {
+		AvailableFlights []lionAirFlight `json:"available_flights"`
+	} `json:"data"`
+}
+
+type lionAirFlight struct {
+	ID      string `json:"id"`
+	Carrier struct {
+		Name string `json:"name"`
+		IATA string `json:"iata"`
+	} `json:"carrier"`
+	Route struct {
+		From lionAirAirport `json:"from"`
+		To   lionAirAirport `json:"to"`
+	} `json:"route"`
+	Schedule struct {
+		Departure         string `json:"departure"`
+		DepartureTimezone string `json:"departure_timezone"`
+		Arrival           string `json:"arrival"`
+		ArrivalTimezone   string `json:"arrival_timezone"`
+	} `json:"schedule"`
+	FlightTime int  `json:"flight_time"`
+	IsDirect   bool `json:"is_direct"`
+	StopCount  int  `json:"stop_count"`
+	Layovers   []struct {
+		Airport         string `json:"airport"`
+		DurationMinutes int    `json:"duration_minutes"`
+	} `json:"layovers"`
+	Pricing struct {
+		Total    int    `json:"total"`
+		Currency string `json:"currency"`
+		FareType string `json:"fare_type"`
+	} `json:"pricing"`
+	SeatsLeft int    `json:"seats_left"`
+	PlaneType string `json:"plane_type"`
+	Services  struct {
+		WifiAvailable    bool `json:"wifi_available"`
+		MealsIncluded    bool `json:"meals_included"`
+		BaggageAllowance struct {
+			Cabin string `json:"cabin"`
+			Hold  string `json:"hold"`
+		} `json:"baggage_allowance"`
+	} `json:"services"`
+}
+
+type lionAirAirport struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	City string `json:"city"`
+}
+
+const lionAirTimeLayout = "2006-01-02T15:04:05"
+
 func (l *LionAirProvider) Name() string { return "Lion Air" }
 func (l *LionAirProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
 	if err := simulateDelay(ctx, 100, 200); err != nil {
 		return nil, err
 	}
 
-	var mock struct {
-		Flights []struct {
-			FlightId string                               `json:"flight_id"`
-			Airline  string                               `json:"airline"`
-			AirlineC string                               `json:"airline_code"`
-			Dep      struct{ Airport, City, Time string } `json:"departure"`
-			Arr      struct{ Airport, City, Time string } `json:"arrival"`
-			DurMins  int                                  `json:"duration_minutes"`
-			Stops    int                                  `json:"stops"`
-			Aircraft string                               `json:"aircraft"`
-			Price    struct{ Amount int }                 `json:"price"`
-			Seats    int                                  `json:"available_seats"`
-			Baggage  struct {
-				CarryOn int
-				Checked int
-			} `json:"baggage"`
-		} `json:"flights"`
+	data, err := readMockData("lion_air_search_response.json")
+	if err != nil {
+		return nil, err
 	}
-
-	if err := readMockData("lion_air_search_response.json", &mock); err != nil {
+	results, err := l.mapResponse(data)
+	if err != nil {
 		return nil, err
 	}
+	return redate(results, req.DepartureDate), nil
+}
 
-	var results []models.Flight
-	for _, f := range mock.Flights {
-		depT, _ := time.Parse(time.RFC3339, f.Dep.Time)
-		arrT, _ := time.Parse(time.RFC3339, f.Arr.Time)
+// mapResponse converts a Lion Air search payload into flights.
+func (l *LionAirProvider) mapResponse(data []byte) ([]models.Flight, error) {
+	var mock lionAirResponse
+	if err := decodeResponse(data, &mock); err != nil {
+		return nil, err
+	}
+	if !mock.Success {
+		return nil, Errorf(KindUnavailable, "Lion Air API returned an unsuccessful response")
+	}
 
-		results = append(results, models.Flight{
-			ID: fmt.Sprintf("%s_Lion", f.FlightId), Provider: l.Name(),
-			Airline:      models.Airline{Name: f.Airline, Code: f.AirlineC},
-			FlightNumber: f.FlightId,
-			Departure:    models.Event{Airport: f.Dep.Airport, City: f.Dep.City, Datetime: f.Dep.Time, Timestamp: depT.Unix()},
-			Arrival:      models.Event{Airport: f.Arr.Airport, City: f.Arr.City, Datetime: f.Arr.Time, Timestamp: arrT.Unix()},
-			Duration:     models.Duration{TotalMinutes: f.DurMins, Formatted: fmt.Sprintf("%dh %dm", f.DurMins/60, f.DurMins%60)},
-			Stops:        f.Stops, AvailableSeats: f.Seats,
-			Price:   models.Price{Amount: f.Price.Amount, Currency: "IDR"},
-			Baggage: models.Baggage{CarryOn: fmt.Sprintf("%d piece(s)", f.Baggage.CarryOn), Checked: fmt.Sprintf("%d piece(s)", f.Baggage.Checked)},
-		})
+	results := make([]models.Flight, 0, len(mock.Data.AvailableFlights))
+	for _, f := range mock.Data.AvailableFlights {
+		flight, err := l.toFlight(f)
+		if err != nil {
+			return nil, Errorf(KindMalformedResponse, "Lion Air flight %s: %w", f.ID, err)
+		}
+		results = append(results, flight)
 	}
 	return results, nil
 }
+
+func (l *LionAirProvider) toFlight(f lionAirFlight) (models.Flight, error) {
+	depT, err := parseLocalTime(f.Schedule.Departure, f.Schedule.DepartureTimezone)
+	if err != nil {
+		return models.Flight{}, fmt.Errorf("departure: %w", err)
+	}
+	arrT, err := parseLocalTime(f.Schedule.Arrival, f.Schedule.ArrivalTimezone)
+	if err != nil {
+		return models.Flight{}, fmt.Errorf("arrival: %w", err)
+	}
+
+	// stop_count is omitted on direct flights, fall back to the layover list
+	stops := f.StopCount
+	if stops == 0 && !f.IsDirect {
+		stops = len(f.Layovers)
+	}
+
+	var amenities []string
+	if f.Services.WifiAvailable {
+		amenities = append(amenities, "wifi")
+	}
+	if f.Services.MealsIncluded {
+		amenities = append(amenities, "meal")
+	}
+
+	var layovers []models.Layover
+	for _, l := range f.Layovers {
+		layovers = append(layovers, models.Layover{Airport: l.Airport, DurationMinutes: l.DurationMinutes})
+	}
+
+	currency := f.Pricing.Currency
+	if currency == "" {
+		currency = "IDR"
+	}
+
+	flight := models.Flight{
+		ID: fmt.Sprintf("%s_Lion", f.ID), Provider: l.Name(),
+		Airline:      models.Airline{Name: f.Carrier.Name, Code: f.Carrier.IATA},
+		FlightNumber: f.ID,
+		Departure:    models.Event{Airport: f.Route.From.Code, City: f.Route.From.City, Datetime: depT.Format(time.RFC3339), Timestamp: depT.Unix()},
+		Arrival:      models.Event{Airport: f.Route.To.Code, City: f.Route.To.City, Datetime: arrT.Format(time.RFC3339), Timestamp: arrT.Unix()},
+		Duration:     models.Duration{TotalMinutes: f.FlightTime, Formatted: fmt.Sprintf("%dh %dm", f.FlightTime/60, f.FlightTime%60)},
+		Stops:        stops, AvailableSeats: f.SeatsLeft,
+		Price:      models.Price{Amount: f.Pricing.Total, Currency: currency},
+		CabinClass: strings.ToLower(f.Pricing.FareType),
+		Aircraft:   optionalString(f.PlaneType),
+		Amenities:  amenities,
+		Baggage:    models.Baggage{CarryOn: f.Services.BaggageAllowance.Cabin, Checked: f.Services.BaggageAllowance.Hold},
+		Layovers:   layovers,
+	}
+	flight.Segments = directSegment(flight)
+	return flight, nil
+}
+
+// parseLocalTime interprets a naive datetime in the given IANA timezone.
+func parseLocalTime(value, zone string) (time.Time, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone %q: %w", zone, err)
+	}
+	return time.ParseInLocation(lionAirTimeLayout, value, loc)
+}
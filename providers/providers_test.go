@@ -1,8 +1,18 @@
 package providers
 
 import (
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"flight-aggregator/models"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -31,6 +41,20 @@ func TestAirAsiaProvider_FetchFlights(t *testing.T) {
 	}
 }
 
+func TestAirAsiaProvider_FillsCity(t *testing.T) {
+	prov := &AirAsiaProvider{}
+	resp, err := prov.FetchFlights(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15"})
+	if err != nil {
+		// Simulated 503, nothing to check
+		t.Skip(err)
+	}
+	for _, f := range resp {
+		if f.Departure.City != "Jakarta" || f.Arrival.City != "Denpasar" {
+			t.Errorf("%s: expected cities from reference data, got %q -> %q", f.FlightNumber, f.Departure.City, f.Arrival.City)
+		}
+	}
+}
+
 func TestBatikAirProvider_FetchFlights(t *testing.T) {
 	prov := &BatikAirProvider{}
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -59,3 +83,520 @@ func TestSimulateDelay_Cancel(t *testing.T) {
 		t.Error("expected error due to context cancel, got nil")
 	}
 }
+
+func TestLionAirProvider_MapsSchema(t *testing.T) {
+	prov := &LionAirProvider{}
+	resp, err := prov.FetchFlights(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp) != 3 {
+		t.Fatalf("expected 3 Lion Air flights, got %d", len(resp))
+	}
+
+	byNumber := make(map[string]models.Flight)
+	for _, f := range resp {
+		byNumber[f.FlightNumber] = f
+	}
+
+	jt740 := byNumber["JT740"]
+	if jt740.Departure.Datetime != "2025-12-15T05:30:00+07:00" || jt740.Arrival.Datetime != "2025-12-15T08:15:00+08:00" {
+		t.Errorf("timezones not applied: %s -> %s", jt740.Departure.Datetime, jt740.Arrival.Datetime)
+	}
+	if got := (jt740.Arrival.Timestamp - jt740.Departure.Timestamp) / 60; got != 105 {
+		t.Errorf("expected 105 minutes between timestamps, got %d", got)
+	}
+	if jt740.Departure.City != "Jakarta" || jt740.Airline.Code != "JT" || jt740.CabinClass != "economy" {
+		t.Errorf("unexpected mapping: %+v", jt740)
+	}
+	if jt740.Aircraft == nil || *jt740.Aircraft != "Boeing 737-900ER" {
+		t.Errorf("expected plane_type as aircraft, got %v", jt740.Aircraft)
+	}
+	if jt740.Baggage.CarryOn != "7 kg" || jt740.Baggage.Checked != "20 kg" {
+		t.Errorf("unexpected baggage: %+v", jt740.Baggage)
+	}
+	if byNumber["JT650"].Stops != 1 || jt740.Stops != 0 {
+		t.Errorf("unexpected stops: JT650=%d JT740=%d", byNumber["JT650"].Stops, jt740.Stops)
+	}
+}
+
+func TestBatikAirProvider_MapsSchema(t *testing.T) {
+	prov := &BatikAirProvider{}
+	resp, err := prov.FetchFlights(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp) != 3 {
+		t.Fatalf("expected 3 Batik Air flights, got %d", len(resp))
+	}
+
+	f := resp[0]
+	if f.FlightNumber != "ID6514" || f.Airline.Code != "ID" {
+		t.Fatalf("unexpected first flight: %+v", f)
+	}
+	if f.Departure.Datetime != "2025-12-15T07:15:00+07:00" || f.Arrival.Datetime != "2025-12-15T10:00:00+08:00" {
+		t.Errorf("offsets not parsed: %s -> %s", f.Departure.Datetime, f.Arrival.Datetime)
+	}
+	if f.Duration.TotalMinutes != 105 {
+		t.Errorf("expected travelTime 1h 45m = 105 minutes, got %d", f.Duration.TotalMinutes)
+	}
+	if f.Price.Amount != 1100000 || f.Price.BaseFare != 980000 || f.Price.Taxes != 120000 {
+		t.Errorf("unexpected price breakdown: %+v", f.Price)
+	}
+	if f.Baggage.CarryOn != "7kg" || f.Baggage.Checked != "20kg" {
+		t.Errorf("unexpected baggage: %+v", f.Baggage)
+	}
+	if f.CabinClass != "economy" || len(f.Amenities) != 2 || f.Amenities[0] != "snack" {
+		t.Errorf("unexpected cabin/amenities: %s %v", f.CabinClass, f.Amenities)
+	}
+	if resp[2].Duration.TotalMinutes != 185 || resp[2].Stops != 1 {
+		t.Errorf("unexpected connecting flight: %+v", resp[2])
+	}
+}
+
+func TestParseTravelTime(t *testing.T) {
+	for in, want := range map[string]int{"1h 45m": 105, "3h 5m": 185, "55m": 55, "2h": 120} {
+		got, err := parseTravelTime(in)
+		if err != nil || got != want {
+			t.Errorf("parseTravelTime(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := parseTravelTime("soon"); err == nil {
+		t.Error("expected error for unparseable travel time")
+	}
+}
+
+func TestGarudaProvider_Segments(t *testing.T) {
+	prov := &GarudaProvider{}
+	resp, err := prov.FetchFlights(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var ga315, ga400 *models.Flight
+	for i := range resp {
+		switch resp[i].FlightNumber {
+		case "GA315":
+			ga315 = &resp[i]
+		case "GA400":
+			ga400 = &resp[i]
+		}
+	}
+	if ga315 == nil || ga400 == nil {
+		t.Fatalf("expected GA315 and GA400 in %+v", resp)
+	}
+
+	if len(ga315.Segments) != 2 || ga315.Segments[1].FlightNumber != "GA332" {
+		t.Fatalf("expected GA315+GA332 segments, got %+v", ga315.Segments)
+	}
+	if ga315.Arrival.Airport != "DPS" || ga315.Stops != 1 {
+		t.Errorf("expected final arrival DPS with 1 stop, got %s with %d", ga315.Arrival.Airport, ga315.Stops)
+	}
+	if len(ga315.Layovers) != 1 || ga315.Layovers[0].Airport != "SUB" || ga315.Layovers[0].DurationMinutes != 105 {
+		t.Errorf("unexpected layovers: %+v", ga315.Layovers)
+	}
+	if ga315.Layovers[0].Overnight {
+		t.Error("same-day layover flagged overnight")
+	}
+
+	if len(ga400.Segments) != 1 || ga400.Segments[0].Arrival.Airport != "DPS" || len(ga400.Layovers) != 0 {
+		t.Errorf("expected one direct segment for GA400, got %+v", ga400.Segments)
+	}
+}
+
+func TestNewLayover_Flags(t *testing.T) {
+	arr := models.Event{Airport: "SUB", Terminal: "1", Datetime: "2025-12-15T23:10:00+07:00", Timestamp: 1765815000}
+	dep := models.Event{Airport: "SUB", Terminal: "2", Datetime: "2025-12-16T06:40:00+07:00", Timestamp: 1765842000}
+	l := models.NewLayover(arr, dep, 0)
+	if l.DurationMinutes != 450 || !l.Overnight || !l.TerminalChange {
+		t.Errorf("unexpected layover: %+v", l)
+	}
+}
+
+func TestRedate(t *testing.T) {
+	prov := &GarudaProvider{}
+	resp, err := prov.FetchFlights(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-01-02"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, f := range resp {
+		if f.Departure.Datetime[:10] != "2026-01-02" {
+			t.Errorf("%s departs %s, expected the requested date", f.FlightNumber, f.Departure.Datetime)
+		}
+		dep, _ := time.Parse(time.RFC3339, f.Departure.Datetime)
+		if dep.Unix() != f.Departure.Timestamp {
+			t.Errorf("%s timestamp not shifted with datetime", f.FlightNumber)
+		}
+		for _, seg := range f.Segments {
+			if seg.Departure.Timestamp < f.Departure.Timestamp || seg.Arrival.Timestamp > f.Arrival.Timestamp {
+				t.Errorf("%s segment %s not shifted", f.FlightNumber, seg.FlightNumber)
+			}
+		}
+	}
+}
+
+func TestErrorRetryability(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		retry bool
+	}{
+		{"unavailable", Errorf(KindUnavailable, "AirAsia API Service Unavailable (503)"), true},
+		{"rate limited", RateLimited(time.Second, "slow down"), true},
+		{"bad request", Errorf(KindBadRequest, "bad origin"), false},
+		{"no availability", Errorf(KindNoAvailability, "sold out"), false},
+		{"auth", Errorf(KindAuth, "expired token"), false},
+		{"malformed", Errorf(KindMalformedResponse, "bad json"), false},
+		{"wrapped", fmt.Errorf("fetch: %w", Errorf(KindUnavailable, "down")), true},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("fetch: %w", context.DeadlineExceeded), false},
+		{"attempt timeout", Errorf(KindUnavailable, "attempt timed out: %w", context.DeadlineExceeded), true},
+		{"unclassified", errors.New("boom"), true},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.retry {
+			t.Errorf("%s: IsRetryable = %v, want %v", tt.name, got, tt.retry)
+		}
+	}
+
+	err := fmt.Errorf("fetch: %w", RateLimited(2*time.Second, "slow down"))
+	if got := RetryAfter(err); got != 2*time.Second {
+		t.Errorf("expected retry-after of 2s, got %v", got)
+	}
+	if got := Errorf(KindUnavailable, "AirAsia API Service Unavailable (503)").Error(); got != "AirAsia API Service Unavailable (503)" {
+		t.Errorf("classification should not change the message, got %q", got)
+	}
+}
+
+func TestKindForStatus(t *testing.T) {
+	tests := map[int]ErrorKind{
+		400: KindBadRequest,
+		401: KindAuth,
+		403: KindAuth,
+		404: KindNoAvailability,
+		429: KindRateLimited,
+		500: KindUnavailable,
+		503: KindUnavailable,
+	}
+	for code, want := range tests {
+		if got := KindForStatus(code); got != want {
+			t.Errorf("KindForStatus(%d) = %s, want %s", code, got, want)
+		}
+	}
+}
+
+// slowProvider answers after its delay unless the context ends first.
+type slowProvider struct {
+	name  string
+	delay time.Duration
+}
+
+func (p *slowProvider) Name() string { return p.name }
+func (p *slowProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	select {
+	case <-time.After(p.delay):
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestRegistry_Build(t *testing.T) {
+	r := BuiltinRegistry()
+	var gotCreds map[string]string
+	if err := r.Register("slow", func(cfg Config) (Provider, error) {
+		gotCreds = cfg.Credentials
+		return &slowProvider{name: "Slow", delay: time.Second}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("garuda", nil); err == nil {
+		t.Error("expected duplicate registration to fail")
+	}
+
+	disabled := false
+	provs, off, err := r.Build([]Config{
+		{Name: "lion_air"},
+		{Name: "garuda", Priority: 5},
+		{Name: "slow", Priority: 1, Timeout: "20ms", Enabled: &disabled, Credentials: map[string]string{"api_key": "k"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, p := range provs {
+		names = append(names, p.Name())
+	}
+	if fmt.Sprint(names) != "[Garuda Indonesia Slow Lion Air]" {
+		t.Errorf("expected providers by priority, got %v", names)
+	}
+	if fmt.Sprint(off) != "[Slow]" || gotCreds["api_key"] != "k" {
+		t.Errorf("unexpected disabled list %v or credentials %v", off, gotCreds)
+	}
+
+	_, err = provs[1].FetchFlights(context.Background(), models.SearchRequest{})
+	if kind, _ := KindOf(err); kind != KindUnavailable || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the configured timeout to surface as unavailable, got %v", err)
+	}
+
+	if _, _, err := r.Build([]Config{{Name: "unknown"}}); err == nil {
+		t.Error("expected an unknown adapter to fail")
+	}
+	if _, _, err := r.Build([]Config{{Name: "garuda", Timeout: "soon"}}); err == nil {
+		t.Error("expected an invalid timeout to fail")
+	}
+	if _, _, err := r.Build([]Config{{Name: "garuda"}, {Name: "lion_air"}, {Name: "garuda", Priority: 2}}); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("expected an adapter configured twice to fail, got %v", err)
+	}
+	if err := r.Register("garuda_backup", func(cfg Config) (Provider, error) { return &GarudaProvider{}, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Build([]Config{{Name: "garuda"}, {Name: "garuda_backup"}}); err == nil || !strings.Contains(err.Error(), "Garuda Indonesia") {
+		t.Errorf("expected two providers with the same name to fail, got %v", err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"PROVIDERS":                 "garuda,lion_air,extra",
+		"PROVIDER_LION_AIR_TIMEOUT": "500ms",
+		"PROVIDER_GARUDA_PRIORITY":  "3",
+		"PROVIDER_GARUDA_API_KEY":   "secret",
+	}
+	cfgs, err := ApplyEnv(DefaultConfig(), func(k string) (string, bool) { v, ok := env[k]; return v, ok })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	byName := make(map[string]Config)
+	for _, c := range cfgs {
+		byName[c.Name] = c
+	}
+	if !byName["garuda"].IsEnabled() || byName["airasia"].IsEnabled() || !byName["extra"].IsEnabled() {
+		t.Errorf("PROVIDERS should select exactly the listed adapters: %+v", cfgs)
+	}
+	if byName["lion_air"].Timeout != "500ms" || byName["garuda"].Priority != 3 || byName["garuda"].Credentials["api_key"] != "secret" {
+		t.Errorf("per-provider overrides not applied: %+v", cfgs)
+	}
+
+	env = map[string]string{"PROVIDER_GARUDA_PRIORITY": "high"}
+	if _, err := ApplyEnv(DefaultConfig(), func(k string) (string, bool) { v, ok := env[k]; return v, ok }); err == nil {
+		t.Error("expected an invalid priority to fail")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfgs, err := LoadConfig(filepath.Join("..", "providers.example.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfgs) != 4 || cfgs[0].Name != "garuda" || cfgs[3].IsEnabled() {
+		t.Errorf("unexpected config: %+v", cfgs)
+	}
+	if _, _, err := BuiltinRegistry().Build(cfgs); err != nil {
+		t.Errorf("example config should build: %v", err)
+	}
+}
+
+// mockDataServer serves a mock_data file at path, recording the last request.
+func mockDataServer(t *testing.T, file, path string, last **http.Request, lastBody *[]byte) *httptest.Server {
+	t.Helper()
+	data, err := readMockData(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		*last = r
+		*lastBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPProvider_MockData(t *testing.T) {
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15", Passengers: "2", CabinClass: "Economy"}
+	cases := []struct {
+		file    string
+		path    string
+		adapter HTTPAdapter
+		mapper  ResponseMapper
+		check   func(r *http.Request, body []byte) error
+	}{
+		{"garuda_indonesia_search_response.json", "/garuda/v1/flights/search", GarudaHTTPAdapter(), (&GarudaProvider{}).mapResponse,
+			func(r *http.Request, _ []byte) error {
+				if q := r.URL.Query(); q.Get("origin") != "CGK" || q.Get("cabin_class") != "economy" || r.Header.Get("X-Api-Key") != "key" {
+					return fmt.Errorf("unexpected request %s %v", r.URL, r.Header)
+				}
+				return nil
+			}},
+		{"airasia_search_response.json", "/airasia/api/search", AirAsiaHTTPAdapter(), (&AirAsiaProvider{}).mapResponse,
+			func(r *http.Request, _ []byte) error {
+				if r.URL.Query().Get("pax") != "2" || r.Header.Get("Authorization") != "Bearer key" {
+					return fmt.Errorf("unexpected request %s %v", r.URL, r.Header)
+				}
+				return nil
+			}},
+		{"batik_air_search_response.json", "/batik/v2/availability", BatikAirHTTPAdapter(), (&BatikAirProvider{}).mapResponse,
+			func(r *http.Request, body []byte) error {
+				var sent struct{ Origin, DepartureDate, Passengers string }
+				if err := json.Unmarshal(body, &sent); err != nil {
+					return fmt.Errorf("body %q: %v", body, err)
+				}
+				if r.Method != http.MethodPost || sent.Origin != "CGK" || sent.DepartureDate != "2025-12-15" || sent.Passengers != "2" {
+					return fmt.Errorf("unexpected request %s %s", r.Method, body)
+				}
+				return nil
+			}},
+		{"lion_air_search_response.json", "/lion/search/flights", LionAirHTTPAdapter(), (&LionAirProvider{}).mapResponse,
+			func(r *http.Request, _ []byte) error {
+				if r.URL.Query().Get("adults") != "2" {
+					return fmt.Errorf("unexpected request %s", r.URL)
+				}
+				return nil
+			}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.adapter.Name, func(t *testing.T) {
+			var last *http.Request
+			var body []byte
+			srv := mockDataServer(t, tc.file, tc.path, &last, &body)
+			prefix := tc.path[:strings.Index(tc.path[1:], "/")+1]
+
+			prov, err := NewHTTPProvider(tc.adapter, HTTPConfig{BaseURL: srv.URL + prefix, APIKey: "key"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := prov.FetchFlights(context.Background(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := tc.check(last, body); err != nil {
+				t.Error(err)
+			}
+
+			data, _ := readMockData(tc.file)
+			want, _ := tc.mapper(data)
+			if len(got) == 0 || !reflect.DeepEqual(got, want) {
+				t.Errorf("expected the mock provider's %d flights, got %d", len(want), len(got))
+			}
+		})
+	}
+}
+
+func TestHTTPProvider_Gzip(t *testing.T) {
+	data, err := readMockData("lion_air_search_response.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("expected gzip to be accepted, got %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(data)
+		gz.Close()
+	}))
+	defer srv.Close()
+
+	prov, err := NewHTTPProvider(LionAirHTTPAdapter(), HTTPConfig{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flights, err := prov.FetchFlights(context.Background(), models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2025-12-15"})
+	if err != nil || len(flights) == 0 {
+		t.Fatalf("expected flights from a gzipped body, got %d, %v", len(flights), err)
+	}
+
+	// The limit applies to the decoded payload, not the compressed one
+	prov, _ = NewHTTPProvider(LionAirHTTPAdapter(), HTTPConfig{BaseURL: srv.URL, MaxResponseBytes: int64(len(data) - 1)})
+	_, err = prov.FetchFlights(context.Background(), models.SearchRequest{})
+	if kind, _ := KindOf(err); kind != KindMalformedResponse {
+		t.Errorf("expected an oversized body to be malformed, got %v", err)
+	}
+}
+
+func TestHTTPProvider_StatusErrors(t *testing.T) {
+	tests := []struct {
+		status     int
+		retryAfter string
+		kind       ErrorKind
+		wait       time.Duration
+	}{
+		{http.StatusTooManyRequests, "2", KindRateLimited, 2 * time.Second},
+		{http.StatusServiceUnavailable, "", KindUnavailable, 0},
+		{http.StatusUnauthorized, "", KindAuth, 0},
+		{http.StatusBadRequest, "", KindBadRequest, 0},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.retryAfter != "" {
+				w.Header().Set("Retry-After", tt.retryAfter)
+			}
+			http.Error(w, "nope", tt.status)
+		}))
+		prov, _ := NewHTTPProvider(GarudaHTTPAdapter(), HTTPConfig{BaseURL: srv.URL})
+		_, err := prov.FetchFlights(context.Background(), models.SearchRequest{})
+		srv.Close()
+
+		if kind, _ := KindOf(err); kind != tt.kind || RetryAfter(err) != tt.wait {
+			t.Errorf("status %d: expected %s waiting %v, got %v (%v)", tt.status, tt.kind, tt.wait, err, RetryAfter(err))
+		}
+		if err != nil && !strings.Contains(err.Error(), "nope") {
+			t.Errorf("status %d: expected the body in the error, got %v", tt.status, err)
+		}
+	}
+}
+
+func TestHTTPProvider_Cancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	prov, _ := NewHTTPProvider(GarudaHTTPAdapter(), HTTPConfig{BaseURL: srv.URL})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := prov.FetchFlights(ctx, models.SearchRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the caller's deadline, got %v", err)
+	}
+}
+
+func TestRegistry_BuildHTTP(t *testing.T) {
+	provs, _, err := BuiltinRegistry().Build([]Config{{Name: "garuda", BaseURL: "http://localhost:9090/garuda"}, {Name: "lion_air"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := provs[0].(*HTTPProvider); !ok || provs[0].Name() != "Garuda Indonesia" {
+		t.Errorf("expected a base URL to select the HTTP adapter, got %T", provs[0])
+	}
+	if _, ok := provs[1].(*LionAirProvider); !ok {
+		t.Errorf("expected the sample data without a base URL, got %T", provs[1])
+	}
+	if _, _, err := BuiltinRegistry().Build([]Config{{Name: "garuda", BaseURL: "not a url"}}); err == nil {
+		t.Error("expected an invalid base URL to fail")
+	}
+}
+
+func TestRegistry_CacheTTL(t *testing.T) {
+	provs, _, err := BuiltinRegistry().Build([]Config{
+		{Name: "garuda", CacheTTL: "30s", Timeout: "1s"},
+		{Name: "lion_air", CacheTTL: "0s"},
+		{Name: "batik_air"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ttls := CacheTTLs(provs)
+	if len(ttls) != 2 || ttls["Garuda Indonesia"] != 30*time.Second || ttls["Lion Air"] != 0 {
+		t.Errorf("unexpected cache TTLs %v", ttls)
+	}
+	if _, _, err := BuiltinRegistry().Build([]Config{{Name: "garuda", CacheTTL: "-1s"}}); err == nil {
+		t.Error("expected a negative cache TTL to fail")
+	}
+}
@@ -0,0 +1,309 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flight-aggregator/models"
+)
+
+// Config describes one provider instance.
+type Config struct {
+	Name        string            `json:"name"`                  // registered adapter name, e.g. "garuda"
+	Enabled     *bool             `json:"enabled,omitempty"`     // defaults to true
+	Timeout     string            `json:"timeout,omitempty"`     // bound on each call as a Go duration, e.g. "800ms"
+	Priority    int               `json:"priority,omitempty"`    // higher priority providers win price ties
+	Credentials map[string]string `json:"credentials,omitempty"` // handed to the adapter as is
+
+	// BaseURL switches a bundled adapter from the sample data to the airline's HTTP API.
+	BaseURL          string            `json:"base_url,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty"`            // sent with every HTTP request
+	MaxResponseBytes int64             `json:"max_response_bytes,omitempty"` // defaults to DefaultMaxResponseBytes
+
+	// CacheTTL overrides how long the aggregator reuses this provider's flights for a
+	// route, as a Go duration; "0s" never caches them.
+	CacheTTL string `json:"cache_ttl,omitempty"`
+}
+
+// IsEnabled reports whether the provider should start out enabled.
+func (c Config) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// HTTPConfig returns the settings for an HTTP provider, taking the API key from
+// credentials["api_key"].
+func (c Config) HTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		BaseURL:          c.BaseURL,
+		APIKey:           c.Credentials["api_key"],
+		Headers:          c.Headers,
+		MaxResponseBytes: c.MaxResponseBytes,
+	}
+}
+
+// Factory creates a provider from its configuration.
+type Factory func(cfg Config) (Provider, error)
+
+// Registry maps adapter names to the factories that build them.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+// BuiltinRegistry returns a registry with the bundled airline adapters.
+func BuiltinRegistry() *Registry {
+	r := NewRegistry()
+	r.mustRegister("garuda", builtin(func() Provider { return &GarudaProvider{} }, GarudaHTTPAdapter))
+	r.mustRegister("airasia", builtin(func() Provider { return &AirAsiaProvider{} }, AirAsiaHTTPAdapter))
+	r.mustRegister("lion_air", builtin(func() Provider { return &LionAirProvider{} }, LionAirHTTPAdapter))
+	r.mustRegister("batik_air", builtin(func() Provider { return &BatikAirProvider{} }, BatikAirHTTPAdapter))
+	return r
+}
+
+// builtin serves the sample data unless a base URL points the adapter at a live API.
+func builtin(mock func() Provider, adapter func() HTTPAdapter) Factory {
+	return func(cfg Config) (Provider, error) {
+		if cfg.BaseURL == "" {
+			return mock(), nil
+		}
+		return NewHTTPProvider(adapter(), cfg.HTTPConfig())
+	}
+}
+
+// Register adds an adapter. Names are unique.
+func (r *Registry) Register(name string, f Factory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.factories[name]; ok {
+		return fmt.Errorf("provider %q already registered", name)
+	}
+	r.factories[name] = f
+	return nil
+}
+
+func (r *Registry) mustRegister(name string, f Factory) {
+	if err := r.Register(name, f); err != nil {
+		panic(err)
+	}
+}
+
+// Names lists the registered adapters in alphabetical order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build creates every configured provider, highest priority first, and returns the
+// names of those configured as disabled so they can be switched on later. Breakers,
+// caches and runtime switches go by provider name, so an adapter configured twice or two
+// providers with the same name are rejected.
+func (r *Registry) Build(cfgs []Config) ([]Provider, []string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	configured := make(map[string]bool, len(cfgs))
+	for _, cfg := range cfgs {
+		if configured[cfg.Name] {
+			return nil, nil, fmt.Errorf("provider %q is configured more than once", cfg.Name)
+		}
+		configured[cfg.Name] = true
+	}
+
+	ordered := append([]Config(nil), cfgs...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Priority > ordered[j].Priority })
+
+	var provs []Provider
+	var disabled []string
+	built := make(map[string]string, len(cfgs)) // provider name to the config that built it
+	for _, cfg := range ordered {
+		factory, ok := r.factories[cfg.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown provider %q", cfg.Name)
+		}
+		prov, err := factory(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("provider %q: %w", cfg.Name, err)
+		}
+		if other, ok := built[prov.Name()]; ok {
+			return nil, nil, fmt.Errorf("providers %q and %q are both named %q", other, cfg.Name, prov.Name())
+		}
+		built[prov.Name()] = cfg.Name
+		if cfg.Timeout != "" {
+			timeout, err := time.ParseDuration(cfg.Timeout)
+			if err != nil || timeout <= 0 {
+				return nil, nil, fmt.Errorf("provider %q: invalid timeout %q", cfg.Name, cfg.Timeout)
+			}
+			prov = &timeoutProvider{Provider: prov, timeout: timeout}
+		}
+		if cfg.CacheTTL != "" {
+			ttl, err := time.ParseDuration(cfg.CacheTTL)
+			if err != nil || ttl < 0 {
+				return nil, nil, fmt.Errorf("provider %q: invalid cache_ttl %q", cfg.Name, cfg.CacheTTL)
+			}
+			prov = &cacheTTLProvider{Provider: prov, ttl: ttl}
+		}
+		provs = append(provs, prov)
+		if !cfg.IsEnabled() {
+			disabled = append(disabled, prov.Name())
+		}
+	}
+	return provs, disabled, nil
+}
+
+// DefaultConfig enables every bundled adapter.
+func DefaultConfig() []Config {
+	return []Config{{Name: "garuda"}, {Name: "airasia"}, {Name: "lion_air"}, {Name: "batik_air"}}
+}
+
+// LoadConfig reads a JSON file of the form {"providers": [{"name": "garuda", ...}]}.
+func LoadConfig(path string) ([]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Providers []Config `json:"providers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return file.Providers, nil
+}
+
+// ApplyEnv overrides the configuration from environment variables:
+//
+//	PROVIDERS=garuda,lion_air      enable exactly these adapters, adding missing ones
+//	PROVIDER_GARUDA_ENABLED=false
+//	PROVIDER_GARUDA_TIMEOUT=800ms
+//	PROVIDER_GARUDA_PRIORITY=2
+//	PROVIDER_GARUDA_API_KEY=secret  stored as credentials["api_key"]
+//	PROVIDER_GARUDA_BASE_URL=https://api.example.com
+//	PROVIDER_GARUDA_CACHE_TTL=30s
+func ApplyEnv(cfgs []Config, lookup func(string) (string, bool)) ([]Config, error) {
+	cfgs = append([]Config(nil), cfgs...)
+
+	if list, ok := lookup("PROVIDERS"); ok {
+		wanted := make(map[string]bool)
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				wanted[name] = true
+			}
+		}
+		for i := range cfgs {
+			enabled := wanted[cfgs[i].Name]
+			cfgs[i].Enabled = &enabled
+			delete(wanted, cfgs[i].Name)
+		}
+		missing := make([]string, 0, len(wanted))
+		for name := range wanted {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		for _, name := range missing {
+			cfgs = append(cfgs, Config{Name: name})
+		}
+	}
+
+	for i := range cfgs {
+		c := &cfgs[i]
+		prefix := "PROVIDER_" + envName(c.Name) + "_"
+		if v, ok := lookup(prefix + "ENABLED"); ok {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("%sENABLED: %w", prefix, err)
+			}
+			c.Enabled = &enabled
+		}
+		if v, ok := lookup(prefix + "TIMEOUT"); ok {
+			c.Timeout = v
+		}
+		if v, ok := lookup(prefix + "PRIORITY"); ok {
+			priority, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%sPRIORITY: %w", prefix, err)
+			}
+			c.Priority = priority
+		}
+		if v, ok := lookup(prefix + "CACHE_TTL"); ok {
+			c.CacheTTL = v
+		}
+		if v, ok := lookup(prefix + "BASE_URL"); ok {
+			c.BaseURL = v
+		}
+		if v, ok := lookup(prefix + "API_KEY"); ok {
+			creds := make(map[string]string, len(c.Credentials)+1)
+			for k, v := range c.Credentials {
+				creds[k] = v
+			}
+			creds["api_key"] = v
+			c.Credentials = creds
+		}
+	}
+	return cfgs, nil
+}
+
+// envName turns an adapter name into its environment variable form, "lion_air" -> "LION_AIR".
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// cacheTTLProvider carries a provider's configured cache TTL to the aggregator.
+type cacheTTLProvider struct {
+	Provider
+	ttl time.Duration
+}
+
+// CacheTTLs returns the cache TTL configured for each provider built by a Registry, by
+// provider name. Providers without one are left out.
+func CacheTTLs(provs []Provider) map[string]time.Duration {
+	ttls := make(map[string]time.Duration)
+	for _, p := range provs {
+		if c, ok := p.(*cacheTTLProvider); ok {
+			ttls[p.Name()] = c.ttl
+		}
+	}
+	return ttls
+}
+
+// timeoutProvider bounds every call to the wrapped provider.
+type timeoutProvider struct {
+	Provider
+	timeout time.Duration
+}
+
+func (p *timeoutProvider) FetchFlights(ctx context.Context, req models.SearchRequest) ([]models.Flight, error) {
+	callCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	flights, err := p.Provider.FetchFlights(callCtx, req)
+	if err != nil && ctx.Err() == nil && callCtx.Err() == context.DeadlineExceeded {
+		// Our own timeout, not the caller's: the provider was too slow this time
+		err = Errorf(KindUnavailable, "%s did not answer within %v: %w", p.Name(), p.timeout, context.DeadlineExceeded)
+	}
+	return flights, err
+}
@@ -0,0 +1,174 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as a Go duration string in JSON, e.g. "150ms".
+type Duration struct{ time.Duration }
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"150ms\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// Fault describes how one airline misbehaves. Latency is uniform between MinLatency and
+// MaxLatency; the rates are the share of requests answered each way, the rest succeed.
+type Fault struct {
+	MinLatency    Duration `json:"min_latency"`
+	MaxLatency    Duration `json:"max_latency"`
+	TimeoutRate   float64  `json:"timeout_rate,omitempty"`    // never answered
+	ErrorRate     float64  `json:"error_rate,omitempty"`      // answered with ErrorStatus
+	ErrorStatus   int      `json:"error_status,omitempty"`    // defaults to 503
+	RateLimitRate float64  `json:"rate_limit_rate,omitempty"` // answered with 429
+	RetryAfter    Duration `json:"retry_after"`               // sent with 429s, rounded up to seconds
+	MalformedRate float64  `json:"malformed_rate,omitempty"`  // truncated JSON
+	EmptyRate     float64  `json:"empty_rate,omitempty"`      // a valid payload without flights
+}
+
+func (f Fault) validate() error {
+	if f.MinLatency.Duration < 0 || f.MaxLatency.Duration < 0 {
+		return fmt.Errorf("negative latency")
+	}
+	if f.MaxLatency.Duration != 0 && f.MaxLatency.Duration < f.MinLatency.Duration {
+		return fmt.Errorf("max_latency %v is below min_latency %v", f.MaxLatency, f.MinLatency)
+	}
+	total := 0.0
+	for _, rate := range []float64{f.TimeoutRate, f.ErrorRate, f.RateLimitRate, f.MalformedRate, f.EmptyRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("rate %v outside [0, 1]", rate)
+		}
+		total += rate
+	}
+	if total > 1 {
+		return fmt.Errorf("fault rates add up to %v, more than 1", total)
+	}
+	if f.ErrorStatus != 0 && (f.ErrorStatus < 400 || f.ErrorStatus > 599) {
+		return fmt.Errorf("error_status %d is not an HTTP error", f.ErrorStatus)
+	}
+	return nil
+}
+
+// Scenario assigns faults to airlines. Airlines without an entry use Default.
+type Scenario struct {
+	Name     string           `json:"name"`
+	Default  Fault            `json:"default"`
+	Airlines map[string]Fault `json:"airlines,omitempty"`
+}
+
+func (sc Scenario) fault(key string) Fault {
+	if f, ok := sc.Airlines[key]; ok {
+		return f
+	}
+	return sc.Default
+}
+
+// Validate checks the fault rates and latencies and that every airline is known.
+func (sc Scenario) Validate() error {
+	if err := sc.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for key, f := range sc.Airlines {
+		if !knownAirline(key) {
+			return fmt.Errorf("unknown airline %q", key)
+		}
+		if err := f.validate(); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func knownAirline(key string) bool {
+	for _, a := range Airlines {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func latencyFault(min, max time.Duration) Fault {
+	return Fault{MinLatency: Duration{min}, MaxLatency: Duration{max}}
+}
+
+// Builtin returns the bundled scenarios by name:
+//
+//	default   the latencies and AirAsia 503 rate of the in-process sample providers
+//	healthy   instant, always successful answers
+//	flaky     every airline slower, with a mix of every fault
+//	outage    Garuda times out, AirAsia is down and Lion Air rate limits
+func Builtin() map[string]Scenario {
+	airasia := latencyFault(50*time.Millisecond, 150*time.Millisecond)
+	airasia.ErrorRate = 0.1
+
+	flaky := latencyFault(100*time.Millisecond, 600*time.Millisecond)
+	flaky.TimeoutRate = 0.05
+	flaky.ErrorRate = 0.1
+	flaky.RateLimitRate = 0.05
+	flaky.RetryAfter = Duration{time.Second}
+	flaky.MalformedRate = 0.05
+	flaky.EmptyRate = 0.05
+
+	timeout := Fault{TimeoutRate: 1}
+	down := Fault{ErrorRate: 1}
+	limited := Fault{RateLimitRate: 1, RetryAfter: Duration{time.Second}}
+
+	return map[string]Scenario{
+		"default": {Name: "default", Airlines: map[string]Fault{
+			"garuda":    latencyFault(50*time.Millisecond, 100*time.Millisecond),
+			"airasia":   airasia,
+			"batik_air": latencyFault(200*time.Millisecond, 400*time.Millisecond),
+			"lion_air":  latencyFault(100*time.Millisecond, 200*time.Millisecond),
+		}},
+		"healthy": {Name: "healthy"},
+		"flaky":   {Name: "flaky", Default: flaky},
+		"outage": {Name: "outage", Airlines: map[string]Fault{
+			"garuda":   timeout,
+			"airasia":  down,
+			"lion_air": limited,
+		}},
+	}
+}
+
+// LoadScenario returns a bundled scenario by name or reads one from a JSON file.
+func LoadScenario(nameOrPath string) (Scenario, error) {
+	if sc, ok := Builtin()[nameOrPath]; ok {
+		return sc, nil
+	}
+	data, err := os.ReadFile(nameOrPath)
+	if err != nil {
+		names := make([]string, 0, len(Builtin()))
+		for name := range Builtin() {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Scenario{}, fmt.Errorf("%q is neither a bundled scenario (%s) nor a readable file: %w",
+			nameOrPath, strings.Join(names, ", "), err)
+	}
+	var sc Scenario
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return Scenario{}, fmt.Errorf("parsing %s: %w", nameOrPath, err)
+	}
+	if err := sc.Validate(); err != nil {
+		return Scenario{}, fmt.Errorf("%s: %w", nameOrPath, err)
+	}
+	return sc, nil
+}
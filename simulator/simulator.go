@@ -0,0 +1,253 @@
+// Package simulator serves the sample airline payloads over HTTP, at the paths the
+// bundled HTTP adapters call, with scenario-driven fault injection.
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Airline describes how one airline is served.
+type Airline struct {
+	Key       string // registry name, used in scenarios and as the path prefix
+	Method    string
+	Path      string // search path below the prefix, as called by the airline's HTTP adapter
+	File      string // sample payload in the data directory
+	DateParam string // query parameter, or JSON body field for POSTs, holding the departure date
+	Empty     string // payload of a search without results
+}
+
+// Prefix is the path under which the airline is served, and the end of its base URL.
+func (a Airline) Prefix() string { return "/" + a.Key }
+
+// Airlines lists the simulated airlines, matching the adapters in the providers package.
+var Airlines = []Airline{
+	{"garuda", http.MethodGet, "/v1/flights/search", "garuda_indonesia_search_response.json", "departure_date",
+		`{"status":"success","flights":[]}`},
+	{"airasia", http.MethodGet, "/api/search", "airasia_search_response.json", "date",
+		`{"status":"ok","flights":[]}`},
+	{"batik_air", http.MethodPost, "/v2/availability", "batik_air_search_response.json", "departureDate",
+		`{"code":200,"message":"OK","results":[]}`},
+	{"lion_air", http.MethodGet, "/search/flights", "lion_air_search_response.json", "date",
+		`{"success":true,"data":{"available_flights":[]}}`},
+}
+
+// sampleDate is the departure date of every sample payload.
+const sampleDate = "2025-12-15"
+
+var datePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// Server simulates the airline APIs. It is safe for concurrent use.
+type Server struct {
+	mux      *http.ServeMux
+	payloads map[string][]byte
+
+	mu       sync.RWMutex
+	scenario Scenario
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithSeed makes fault injection and latency deterministic.
+func WithSeed(seed int64) Option {
+	return func(s *Server) {
+		s.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// NewServer loads the sample payloads from dataDir and serves them under sc. Besides
+// the airline paths it exposes GET and PUT /_simulator/scenario to swap the scenario
+// while running.
+func NewServer(dataDir string, sc Scenario, opts ...Option) (*Server, error) {
+	s := &Server{
+		mux:      http.NewServeMux(),
+		payloads: make(map[string][]byte),
+		scenario: sc,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	for _, a := range Airlines {
+		data, err := os.ReadFile(filepath.Join(dataDir, a.File))
+		if err != nil {
+			return nil, err
+		}
+		s.payloads[a.Key] = data
+		s.mux.HandleFunc(a.Method+" "+a.Prefix()+a.Path, s.handleSearch(a))
+	}
+	s.mux.HandleFunc("GET /_simulator/scenario", s.handleGetScenario)
+	s.mux.HandleFunc("PUT /_simulator/scenario", s.handlePutScenario)
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Scenario returns the scenario currently served.
+func (s *Server) Scenario() Scenario {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.scenario
+}
+
+// SetScenario replaces the scenario for requests arriving from now on.
+func (s *Server) SetScenario(sc Scenario) {
+	s.mu.Lock()
+	s.scenario = sc
+	s.mu.Unlock()
+}
+
+// outcome is what a single request is answered with.
+type outcome int
+
+const (
+	outcomeOK outcome = iota
+	outcomeTimeout
+	outcomeError
+	outcomeRateLimit
+	outcomeMalformed
+	outcomeEmpty
+)
+
+// roll picks the latency and outcome of a request.
+func (s *Server) roll(f Fault) (time.Duration, outcome) {
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+
+	latency := f.MinLatency.Duration
+	if spread := f.MaxLatency.Duration - f.MinLatency.Duration; spread > 0 {
+		latency += time.Duration(s.rand.Int63n(int64(spread)))
+	}
+
+	p := s.rand.Float64()
+	for _, o := range []struct {
+		rate    float64
+		outcome outcome
+	}{
+		{f.TimeoutRate, outcomeTimeout},
+		{f.ErrorRate, outcomeError},
+		{f.RateLimitRate, outcomeRateLimit},
+		{f.MalformedRate, outcomeMalformed},
+		{f.EmptyRate, outcomeEmpty},
+	} {
+		if p < o.rate {
+			return latency, o.outcome
+		}
+		p -= o.rate
+	}
+	return latency, outcomeOK
+}
+
+func (s *Server) handleSearch(a Airline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		date, err := requestDate(r, a)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		fault := s.Scenario().fault(a.Key)
+		latency, outcome := s.roll(fault)
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch outcome {
+		case outcomeTimeout:
+			// Never answer, the client has to give up
+			<-r.Context().Done()
+		case outcomeError:
+			status := fault.ErrorStatus
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error":%q}`, http.StatusText(status))
+		case outcomeRateLimit:
+			if wait := fault.RetryAfter.Duration; wait > 0 {
+				w.Header().Set("Retry-After", fmt.Sprint(int((wait+time.Second-1)/time.Second)))
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"error":"rate limit exceeded"}`)
+		case outcomeMalformed:
+			payload := s.payloads[a.Key]
+			w.Write(payload[:len(payload)/2])
+		case outcomeEmpty:
+			io.WriteString(w, a.Empty)
+		default:
+			w.Write(redate(s.payloads[a.Key], date))
+		}
+	}
+}
+
+// requestDate reads the departure date the way the airline's adapter sends it.
+func requestDate(r *http.Request, a Airline) (string, error) {
+	if a.Method != http.MethodPost {
+		return r.URL.Query().Get(a.DateParam), nil
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid request body: %v", err)
+	}
+	date, _ := body[a.DateParam].(string)
+	return date, nil
+}
+
+// redate moves every date in a sample payload by the distance between the sample day
+// and the requested one, so the simulator can answer for any day. Payloads are left
+// alone when no valid date was requested.
+func redate(payload []byte, date string) []byte {
+	target, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return payload
+	}
+	sample, _ := time.Parse("2006-01-02", sampleDate)
+	days := int(target.Sub(sample).Hours() / 24)
+	if days == 0 {
+		return payload
+	}
+	return datePattern.ReplaceAllFunc(payload, func(m []byte) []byte {
+		t, err := time.Parse("2006-01-02", string(m))
+		if err != nil {
+			return m
+		}
+		return []byte(t.AddDate(0, 0, days).Format("2006-01-02"))
+	})
+}
+
+func (s *Server) handleGetScenario(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Scenario())
+}
+
+func (s *Server) handlePutScenario(w http.ResponseWriter, r *http.Request) {
+	var sc Scenario
+	if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := sc.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.SetScenario(sc)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sc)
+}
@@ -0,0 +1,188 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"flight-aggregator/aggregator"
+	"flight-aggregator/models"
+	"flight-aggregator/providers"
+)
+
+func newTestServer(t *testing.T, sc Scenario) (*Server, *httptest.Server) {
+	t.Helper()
+	sim, err := NewServer("../mock_data", sc, WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(sim)
+	t.Cleanup(srv.Close)
+	return sim, srv
+}
+
+// simulatedProviders builds every bundled adapter against the simulator, each bounded
+// to 300ms so timeout faults fail the provider rather than the search.
+func simulatedProviders(t *testing.T, baseURL string) []providers.Provider {
+	t.Helper()
+	var cfgs []providers.Config
+	for _, a := range Airlines {
+		cfgs = append(cfgs, providers.Config{Name: a.Key, BaseURL: baseURL + a.Prefix(), Timeout: "300ms"})
+	}
+	provs, _, err := providers.BuiltinRegistry().Build(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provs
+}
+
+func TestServer_Adapters(t *testing.T) {
+	_, srv := newTestServer(t, Builtin()["healthy"])
+	req := models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: "2026-12-20", Passengers: "1"}
+
+	for _, prov := range simulatedProviders(t, srv.URL) {
+		flights, err := prov.FetchFlights(context.Background(), req)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", prov.Name(), err)
+			continue
+		}
+		if len(flights) == 0 {
+			t.Errorf("%s: expected flights", prov.Name())
+		}
+		for _, f := range flights {
+			if !strings.HasPrefix(f.Departure.Datetime, req.DepartureDate) {
+				t.Errorf("%s: expected %s to be moved to the requested date", prov.Name(), f.Departure.Datetime)
+			}
+		}
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault Fault
+		check func(flights []models.Flight, err error) bool
+	}{
+		{"error", Fault{ErrorRate: 1}, func(_ []models.Flight, err error) bool {
+			kind, _ := providers.KindOf(err)
+			return kind == providers.KindUnavailable
+		}},
+		{"error status", Fault{ErrorRate: 1, ErrorStatus: http.StatusUnauthorized}, func(_ []models.Flight, err error) bool {
+			kind, _ := providers.KindOf(err)
+			return kind == providers.KindAuth
+		}},
+		{"rate limit", Fault{RateLimitRate: 1, RetryAfter: Duration{1500 * time.Millisecond}}, func(_ []models.Flight, err error) bool {
+			return providers.RetryAfter(err) == 2*time.Second
+		}},
+		{"malformed", Fault{MalformedRate: 1}, func(_ []models.Flight, err error) bool {
+			kind, _ := providers.KindOf(err)
+			return kind == providers.KindMalformedResponse
+		}},
+		{"empty", Fault{EmptyRate: 1}, func(flights []models.Flight, err error) bool {
+			return err == nil && len(flights) == 0
+		}},
+		{"timeout", Fault{TimeoutRate: 1}, func(_ []models.Flight, err error) bool {
+			return errors.Is(err, context.DeadlineExceeded)
+		}},
+	}
+
+	sim, srv := newTestServer(t, Scenario{})
+	for _, tt := range tests {
+		sim.SetScenario(Scenario{Name: tt.name, Default: tt.fault})
+		for _, prov := range simulatedProviders(t, srv.URL) {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			flights, err := prov.FetchFlights(ctx, models.SearchRequest{DepartureDate: "2026-12-20"})
+			cancel()
+			if !tt.check(flights, err) {
+				t.Errorf("%s, %s: unexpected result %d flights, %v", tt.name, prov.Name(), len(flights), err)
+			}
+		}
+	}
+}
+
+func TestServer_Latency(t *testing.T) {
+	_, srv := newTestServer(t, Scenario{Default: Fault{MinLatency: Duration{30 * time.Millisecond}, MaxLatency: Duration{40 * time.Millisecond}}})
+	prov := simulatedProviders(t, srv.URL)[0]
+
+	start := time.Now()
+	if _, err := prov.FetchFlights(context.Background(), models.SearchRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("expected at least the minimum latency, answered after %v", elapsed)
+	}
+}
+
+func TestServer_PutScenario(t *testing.T) {
+	sim, srv := newTestServer(t, Builtin()["healthy"])
+
+	put := func(body string) int {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/_simulator/scenario", strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := put(`{"name":"down","airlines":{"garuda":{"error_rate":1,"min_latency":"5ms"}}}`); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if sc := sim.Scenario(); sc.Name != "down" || sc.fault("garuda").MinLatency.Duration != 5*time.Millisecond || sc.fault("lion_air").ErrorRate != 0 {
+		t.Errorf("scenario not applied: %+v", sc)
+	}
+	for _, body := range []string{
+		`{"default":{"error_rate":0.7,"timeout_rate":0.5}}`,
+		`{"airlines":{"unknown":{}}}`,
+		`{"default":{"min_latency":"soon"}}`,
+	} {
+		if code := put(body); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, code)
+		}
+	}
+}
+
+func TestBuiltinScenarios(t *testing.T) {
+	for name, sc := range Builtin() {
+		if err := sc.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := LoadScenario("no-such-scenario"); err == nil {
+		t.Error("expected an unknown scenario to fail")
+	}
+}
+
+func TestRedate(t *testing.T) {
+	got := string(redate([]byte(`{"dep":"2025-12-15T23:00:00+07:00","arr":"2025-12-16T01:00:00+07:00"}`), "2026-03-01"))
+	if got != `{"dep":"2026-03-01T23:00:00+07:00","arr":"2026-03-02T01:00:00+07:00"}` {
+		t.Errorf("unexpected redate: %s", got)
+	}
+}
+
+// TestEndToEnd runs the aggregator over HTTP against the simulator.
+func TestEndToEnd(t *testing.T) {
+	_, srv := newTestServer(t, Builtin()["outage"])
+	agg := aggregator.NewAggregatorService(simulatedProviders(t, srv.URL),
+		aggregator.WithRetryPolicy(aggregator.RetryPolicy{MaxAttempts: 1}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	date := time.Now().AddDate(0, 0, 30).Format("2006-01-02")
+	resp, err := agg.Search(ctx, models.SearchRequest{Origin: "CGK", Destination: "DPS", DepartureDate: date, Passengers: "9"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Metadata.ProvidersSucceeded != 1 || len(resp.Flights) == 0 {
+		t.Errorf("expected only Batik Air to answer, got %+v", resp.Metadata)
+	}
+	for _, f := range resp.Flights {
+		if f.Provider != "Batik Air" {
+			t.Errorf("unexpected flight from %s", f.Provider)
+		}
+	}
+}